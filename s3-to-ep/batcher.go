@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	batchMaxBytesEnvKey  = "BATCH_MAX_BYTES"
+	batchMaxEventsEnvKey = "BATCH_MAX_EVENTS"
+	batchMaxLingerEnvKey = "BATCH_MAX_LINGER"
+
+	defaultBatchMaxBytes  = 1024 * 1024
+	defaultBatchMaxEvents = 1000
+	defaultBatchMaxLinger = 5 * time.Second
+)
+
+// hecBatcher concatenates payloads sharing the same EP url into a single request body.
+// A batch is sent when it reaches maxBytes or maxEvents, when the oldest payload has been waiting for
+// maxLinger or when the url changes. flush must be called once all payloads are added.
+// The linger timer sends the batch from its own goroutine, so the batch is guarded by mu.
+type hecBatcher struct {
+	cfg        *Config
+	httpClient *http.Client
+	maxBytes   int
+	maxEvents  int
+	maxLinger  time.Duration
+	retry      *retryPolicy
+
+	mu         sync.Mutex
+	epUrl      string
+	body       bytes.Buffer
+	eventCount int
+	startTime  time.Time
+	// lingerTimer sends the batch once it is maxLinger old, even if no payload is added meanwhile
+	lingerTimer *time.Timer
+	// batchNumber tells the linger timer whether the batch it was started for has already been sent
+	batchNumber int
+
+	// recordIDs are the records with payloads in the current batch
+	recordIDs            []string
+	lastRecordID         string
+	lastRecordOffset     int
+	lastRecordEventCount int
+	// failures are the errors of records whose batch failed to be sent
+	failures map[string]error
+}
+
+func buildHecBatcher(cfg *Config, httpClient *http.Client) *hecBatcher {
+	return &hecBatcher{
+		cfg:        cfg,
+		httpClient: httpClient,
+		maxBytes:   cfg.BatchMaxBytes,
+		maxEvents:  cfg.BatchMaxEvents,
+		maxLinger:  cfg.BatchMaxLinger,
+		retry:      buildRetryPolicy(cfg),
+		failures:   make(map[string]error),
+	}
+}
+
+// add appends the payload of the record identified by recordID to the current batch.
+// If the batch can't be sent, all records with payloads in the batch are marked as failed.
+func (b *hecBatcher) add(ctx context.Context, recordID, epUrl string, payload []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// the linger timer may have failed to send earlier payloads of the record
+	if err := b.failures[recordID]; err != nil {
+		return err
+	}
+	if b.eventCount > 0 && (epUrl != b.epUrl || b.body.Len()+len(payload) > b.maxBytes) {
+		if err := b.flushLocked(ctx); err != nil {
+			return err
+		}
+	}
+
+	if b.eventCount == 0 {
+		b.epUrl = epUrl
+		b.startTime = time.Now()
+		batchNumber := b.batchNumber
+		b.lingerTimer = time.AfterFunc(b.maxLinger, func() {
+			b.flushLingering(ctx, batchNumber)
+		})
+	}
+	if b.lastRecordID != recordID || b.lastRecordEventCount == 0 {
+		b.lastRecordID = recordID
+		b.lastRecordOffset = b.body.Len()
+		b.lastRecordEventCount = 0
+		b.recordIDs = append(b.recordIDs, recordID)
+	}
+	b.body.Write(payload)
+	b.eventCount++
+	b.lastRecordEventCount++
+
+	if b.eventCount >= b.maxEvents || b.body.Len() >= b.maxBytes || time.Since(b.startTime) >= b.maxLinger {
+		return b.flushLocked(ctx)
+	}
+	return nil
+}
+
+// flushLingering sends the batch numbered batchNumber if it hasn't been sent yet.
+func (b *hecBatcher) flushLingering(ctx context.Context, batchNumber int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.batchNumber != batchNumber {
+		return
+	}
+	if err := b.flushLocked(ctx); err != nil {
+		log.Printf("error sending lingering batch: %s", err)
+	}
+}
+
+func (b *hecBatcher) flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked(ctx)
+}
+
+func (b *hecBatcher) flushLocked(ctx context.Context) error {
+	if b.eventCount == 0 {
+		return nil
+	}
+	defer b.reset()
+
+	err := b.send(ctx)
+	if err != nil {
+		for _, recordID := range b.recordIDs {
+			b.failures[recordID] = err
+		}
+	}
+	return err
+}
+
+func (b *hecBatcher) send(ctx context.Context) error {
+	httpReq, err := buildHTTPReq(b.cfg, b.epUrl, b.body.Bytes())
+	if err != nil {
+		log.Printf("error building http request: %s", err)
+		return err
+	}
+
+	if err = b.retry.do(ctx, b.httpClient, httpReq); err != nil {
+		log.Printf("error sending batch to EP: %s", err)
+		return err
+	}
+
+	log.Printf("sent batch to EP. Event count: %d, Size: %d", b.eventCount, b.body.Len())
+	return nil
+}
+
+// discard drops the payloads of the record which haven't been sent yet.
+// Records are added one after another so its payloads are always at the end of the batch.
+func (b *hecBatcher) discard(recordID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.lastRecordID != recordID || b.lastRecordEventCount == 0 {
+		return
+	}
+
+	b.body.Truncate(b.lastRecordOffset)
+	b.eventCount -= b.lastRecordEventCount
+	b.recordIDs = b.recordIDs[:len(b.recordIDs)-1]
+	b.lastRecordEventCount = 0
+	if b.eventCount == 0 {
+		b.reset()
+	}
+}
+
+// failure returns the error of the batch the record was part of, if any.
+func (b *hecBatcher) failure(recordID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures[recordID]
+}
+
+func (b *hecBatcher) reset() {
+	if b.lingerTimer != nil {
+		b.lingerTimer.Stop()
+		b.lingerTimer = nil
+	}
+	b.batchNumber++
+	b.epUrl = ""
+	b.body.Reset()
+	b.eventCount = 0
+	b.recordIDs = nil
+	b.lastRecordID = ""
+	b.lastRecordEventCount = 0
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testBatchURL      = "http://localhost/services/collector"
+	testOtherBatchURL = "http://localhost/services/collector/raw"
+)
+
+func registerBatchResponder(t *testing.T, url string, statusCode int) *[]string {
+	var bodies []string
+	httpmock.RegisterResponder(http.MethodPost, url, func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+		return httpmock.NewStringResponse(statusCode, ""), nil
+	})
+	return &bodies
+}
+
+func Test_buildHecBatcher_noEnvSet_useDefault(t *testing.T) {
+	batcher := buildHecBatcher(buildTestConfig(t), &http.Client{})
+	assert.Equal(t, defaultBatchMaxBytes, batcher.maxBytes)
+	assert.Equal(t, defaultBatchMaxEvents, batcher.maxEvents)
+	assert.Equal(t, defaultBatchMaxLinger, batcher.maxLinger)
+}
+
+func Test_hecBatcher_batching(t *testing.T) {
+	tests := []struct {
+		name           string
+		envs           map[string]string
+		payloads       []string
+		urls           []string
+		expectedBodies []string
+	}{
+		{
+			name:           "all payloads are sent in one batch",
+			payloads:       []string{"a", "b", "c"},
+			expectedBodies: []string{"abc"},
+		},
+		{
+			name: "batch is sent when max events is reached",
+			envs: map[string]string{
+				batchMaxEventsEnvKey: "2",
+			},
+			payloads:       []string{"a", "b", "c"},
+			expectedBodies: []string{"ab", "c"},
+		},
+		{
+			name: "batch is sent before exceeding max bytes",
+			envs: map[string]string{
+				batchMaxBytesEnvKey: "5",
+			},
+			payloads:       []string{"aa", "bb", "cc", "dddddd"},
+			expectedBodies: []string{"aabb", "cc", "dddddd"},
+		},
+		{
+			name: "batch is sent when max linger is exceeded",
+			envs: map[string]string{
+				batchMaxLingerEnvKey: "1ns",
+			},
+			payloads:       []string{"a", "b"},
+			expectedBodies: []string{"a", "b"},
+		},
+		{
+			name:           "batch is sent when url changes",
+			payloads:       []string{"a", "b", "c"},
+			urls:           []string{testBatchURL, testOtherBatchURL, testOtherBatchURL},
+			expectedBodies: []string{"a", "bc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, val := range tt.envs {
+				assert.NoError(t, os.Setenv(key, val))
+			}
+			t.Cleanup(func() {
+				for key := range tt.envs {
+					_ = os.Unsetenv(key)
+				}
+			})
+
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+
+			var bodies []string
+			httpmock.RegisterNoResponder(func(req *http.Request) (*http.Response, error) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				bodies = append(bodies, string(body))
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+
+			batcher := buildHecBatcher(buildTestConfig(t), &http.Client{})
+
+			for i, payload := range tt.payloads {
+				url := testBatchURL
+				if tt.urls != nil {
+					url = tt.urls[i]
+				}
+				assert.NoError(t, batcher.add(context.Background(), "test-record", url, []byte(payload)))
+			}
+			assert.NoError(t, batcher.flush(context.Background()))
+			assert.Equal(t, tt.expectedBodies, bodies)
+		})
+	}
+}
+
+func Test_hecBatcher_flush(t *testing.T) {
+	tests := []struct {
+		name        string
+		payloads    []string
+		statusCode  int
+		expectedErr bool
+		expectCall  bool
+	}{
+		{
+			name:       "empty batch doesn't make http call",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "batch is sent successfully",
+			payloads:   []string{"a"},
+			statusCode: http.StatusOK,
+			expectCall: true,
+		},
+		{
+			name:        "batch ran into client error",
+			payloads:    []string{"a"},
+			statusCode:  http.StatusBadRequest,
+			expectedErr: true,
+			expectCall:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			bodies := registerBatchResponder(t, testBatchURL, tt.statusCode)
+
+			batcher := buildHecBatcher(buildTestConfig(t), &http.Client{})
+			for _, payload := range tt.payloads {
+				assert.NoError(t, batcher.add(context.Background(), "test-record", testBatchURL, []byte(payload)))
+			}
+
+			err := batcher.flush(context.Background())
+			if tt.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectCall, len(*bodies) == 1)
+			assert.Zero(t, batcher.eventCount)
+		})
+	}
+}
+
+func Test_hecBatcher_add_lingeringBatchSentByTimer(t *testing.T) {
+	assert.NoError(t, os.Setenv(batchMaxLingerEnvKey, "10ms"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(batchMaxLingerEnvKey)
+	})
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	sent := make(chan string, 1)
+	httpmock.RegisterResponder(http.MethodPost, testBatchURL, func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		sent <- string(body)
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	batcher := buildHecBatcher(buildTestConfig(t), &http.Client{})
+	assert.NoError(t, batcher.add(context.Background(), "record-1", testBatchURL, []byte("a")))
+
+	// the batch is sent without another payload being added
+	select {
+	case body := <-sent:
+		assert.Equal(t, "a", body)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "lingering batch wasn't sent")
+	}
+	assert.NoError(t, batcher.flush(context.Background()))
+}
+
+func Test_hecBatcher_add_lingeringBatchFailed_recordFailed(t *testing.T) {
+	assert.NoError(t, os.Setenv(batchMaxLingerEnvKey, "10ms"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(batchMaxLingerEnvKey)
+	})
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	sent := make(chan struct{}, 1)
+	httpmock.RegisterResponder(http.MethodPost, testBatchURL, func(req *http.Request) (*http.Response, error) {
+		sent <- struct{}{}
+		return httpmock.NewStringResponse(http.StatusBadRequest, ""), nil
+	})
+
+	batcher := buildHecBatcher(buildTestConfig(t), &http.Client{})
+	assert.NoError(t, batcher.add(context.Background(), "record-1", testBatchURL, []byte("a")))
+	<-sent
+
+	// the timer holds the batch lock while sending, so the next call sees the record failure
+	assert.Error(t, batcher.add(context.Background(), "record-1", testBatchURL, []byte("b")))
+	assert.NoError(t, batcher.flush(context.Background()))
+	assert.Error(t, batcher.failure("record-1"))
+}
+
+func Test_hecBatcher_discard_dropsPendingRecordPayloads(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	bodies := registerBatchResponder(t, testBatchURL, http.StatusOK)
+
+	batcher := buildHecBatcher(buildTestConfig(t), &http.Client{})
+
+	ctx := context.Background()
+	assert.NoError(t, batcher.add(ctx, "record-1", testBatchURL, []byte("a")))
+	assert.NoError(t, batcher.add(ctx, "record-2", testBatchURL, []byte("b")))
+	assert.NoError(t, batcher.add(ctx, "record-2", testBatchURL, []byte("c")))
+	batcher.discard("record-1")
+	batcher.discard("record-2")
+	assert.NoError(t, batcher.flush(ctx))
+
+	assert.Equal(t, []string{"a"}, *bodies)
+}
+
+func Test_hecBatcher_flushFailure_recordsInBatchFailed(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	registerBatchResponder(t, testBatchURL, http.StatusBadRequest)
+
+	assert.NoError(t, os.Setenv(batchMaxEventsEnvKey, "2"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(batchMaxEventsEnvKey)
+	})
+	batcher := buildHecBatcher(buildTestConfig(t), &http.Client{})
+
+	ctx := context.Background()
+	assert.NoError(t, batcher.add(ctx, "record-1", testBatchURL, []byte("a")))
+	assert.Error(t, batcher.add(ctx, "record-2", testBatchURL, []byte("b")))
+	assert.NoError(t, batcher.flush(ctx))
+
+	assert.Error(t, batcher.failure("record-1"))
+	assert.Error(t, batcher.failure("record-2"))
+	assert.NoError(t, batcher.failure("record-3"))
+}
@@ -2,4 +2,8 @@
 
 # TODO: handle building in windows properly
 GOOS=linux GOARCH=amd64 CGO_ENABLED=0 go build -o main *.go
-zip s3-to-ep.zip main
\ No newline at end of file
+zip s3-to-ep.zip main
+# bundle the configuration document if provided
+if [ -f config.yaml ]; then
+  zip s3-to-ep.zip config.yaml
+fi
@@ -2,14 +2,15 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -20,133 +21,250 @@ const (
 	epTLSClientPrivateKeyEnvKey = "TLS_CLIENT_KEY"
 	epTLSCACertEnvKey           = "TLS_CLIENT_CA_CERT"
 	encodingMethodEnvKey        = "ENCODING_METHOD"
+	compressionLevelEnvKey      = "COMPRESSION_LEVEL"
+	hecTokenEnvKey              = "HEC_TOKEN"
+	hecTokenInQueryEnvKey       = "HEC_TOKEN_IN_QUERY"
 
 	sourcetypeEnvKey = "EVENT_SOURCETYPE"
 	indexEnvKey      = "EVENT_INDEX"
 	eventIsRawEnvKey = "EVENT_IS_RAW"
+	fieldsEnvKey     = "EVENT_FIELDS"
 
 	defaultSourcetype = "archived_data"
 	defaultIndex      = "main"
-	defaultHostName   = "unknownHost"
 	gzipEncoding      = "gzip"
 
+	httpMaxIdleConns    = 100
+	httpIdleConnTimeout = 90 * time.Second
+
 	formattedEndpointSuffix = "/services/collector"
 	rawEndpointSuffix       = "/services/collector/raw"
+
+	hecAuthorizationScheme = "Splunk "
+	hecTokenQueryKey       = "token"
+	redactedValue          = "REDACTED"
 )
 
+// hecEvent follows the HEC event protocol.
+// Time is in epoch seconds with sub-second precision. If not set, EP uses the time the event is received.
+// Fields are indexed fields added on top of the event.
 type hecEvent struct {
-	Time       int64  `json:"Time"`
-	Host       string `json:"Host"`
-	Source     string `json:"Source"`
-	Sourcetype string `json:"Sourcetype"`
-	Index      string `json:"Index"`
-	Event      string `json:"Event"`
+	Time       float64           `json:"time,omitempty"`
+	Host       string            `json:"host,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Sourcetype string            `json:"sourcetype,omitempty"`
+	Index      string            `json:"index,omitempty"`
+	Event      string            `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
 }
 
-func buildHTTPClient() (*http.Client, error) {
-	client := &http.Client{}
-	clientCert := os.Getenv(epTLSClientCertEnvKey)
-	clientKey := os.Getenv(epTLSClientPrivateKeyEnvKey)
+// hecTime converts t to HEC epoch seconds with millisecond precision.
+func hecTime(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixMilli()) / 1000
+}
 
-	if clientCert != "" && clientKey != "" {
-		cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
-		if err != nil {
-			return nil, err
-		}
+// parseFields parses indexed fields in the format of key1=value1,key2=value2.
+func parseFields(fieldsStr string) (map[string]string, error) {
+	if fieldsStr == "" {
+		return nil, nil
+	}
 
-		certPool, err := x509.SystemCertPool()
-		if err != nil {
-			certPool = x509.NewCertPool()
+	fields := make(map[string]string)
+	for _, pair := range strings.Split(fieldsStr, ",") {
+		key, val, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("%s has invalid field %q. Expected format is key=value", fieldsEnvKey, pair)
 		}
-		caCert := os.Getenv(epTLSCACertEnvKey)
-		if caCert != "" {
-			certPool.AppendCertsFromPEM([]byte(caCert))
+		fields[key] = strings.TrimSpace(val)
+	}
+	return fields, nil
+}
+
+// buildHTTPTransport keeps idle connections to EP open between invocations so warm invocations reuse
+// TCP connections and TLS sessions instead of handshaking again.
+func buildHTTPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = httpMaxIdleConns
+	transport.MaxIdleConnsPerHost = httpMaxIdleConns
+	transport.IdleConnTimeout = httpIdleConnTimeout
+	return transport
+}
+
+func buildHTTPClient(cfg *Config) *http.Client {
+	transport := buildHTTPTransport()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	applyTLSConfig(cfg, transport.TLSClientConfig)
+	return &http.Client{Transport: transport}
+}
+
+// hecPayloadBuilder turns the content of a single S3 record into payloads to send to epUrl.
+// Each payload is a complete HEC event, or a raw event ending with a line break,
+// so payloads sharing the same url can be concatenated into a single request body.
+// The time of the template is used for events whose timestamp can't be extracted.
+// Events keep the time and metadata found by the decoder, if any, and add its fields to the template fields.
+// Events bigger than maxEventSize are truncated whatever their decoder.
+type hecPayloadBuilder struct {
+	epUrl        string
+	isRawEvent   bool
+	template     hecEvent
+	decoder      eventDecoder
+	timestamps   *timestampExtractor
+	maxEventSize int
+}
+
+func (b *hecPayloadBuilder) build(reader io.Reader, emit func(payload []byte) error) error {
+	return b.decoder.decode(reader, b.emitter(emit))
+}
+
+// emitter returns the function turning decoded events into payloads passed to emit.
+func (b *hecPayloadBuilder) emitter(emit func(payload []byte) error) func(decoded decodedEvent) error {
+	return func(decoded decodedEvent) error {
+		decoded.content = truncateEvent(decoded.content, b.maxEventSize)
+		if b.isRawEvent {
+			return emit([]byte(decoded.content + "\n"))
 		}
 
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				Certificates: []tls.Certificate{cert},
-				RootCAs:      certPool,
-			},
+		event := b.template
+		event.Event = decoded.content
+		if decoded.host != "" {
+			event.Host = decoded.host
+		}
+		if decoded.source != "" {
+			event.Source = decoded.source
+		}
+		if decoded.sourcetype != "" {
+			event.Sourcetype = decoded.sourcetype
+		}
+		if len(decoded.fields) > 0 {
+			event.Fields = make(map[string]string, len(b.template.Fields)+len(decoded.fields))
+			for key, value := range b.template.Fields {
+				event.Fields[key] = value
+			}
+			for key, value := range decoded.fields {
+				event.Fields[key] = value
+			}
+		}
+		if !decoded.time.IsZero() {
+			event.Time = hecTime(decoded.time)
+		} else if b.timestamps != nil {
+			if timestamp, found := b.timestamps.extract(decoded.content); found {
+				event.Time = hecTime(timestamp)
+			}
 		}
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return emit(eventBytes)
 	}
-	return client, nil
 }
 
-func buildPostBody(isRawEvent bool, record events.S3EventRecord, host, sourcetype, index, s3Content string) ([]byte, error) {
-	if isRawEvent {
-		return []byte(s3Content), nil
+// buildURL returns the EP url to send events to. Raw events take their metadata from the url query.
+func buildURL(cfg *Config, template hecEvent) string {
+	epUrl := *cfg.EPHost
+	if !cfg.IsRawEvent {
+		epUrl.Path = formattedEndpointSuffix
+		return epUrl.String()
 	}
 
-	event := hecEvent{
-		Time:       record.EventTime.Unix(),
-		Host:       host,
-		Source:     record.EventSource,
-		Sourcetype: sourcetype,
-		Index:      index,
-		Event:      s3Content,
+	epUrl.Path = rawEndpointSuffix
+	query := epUrl.Query()
+	query.Set("host", template.Host)
+	query.Set("source", template.Source)
+	query.Set("sourcetype", template.Sourcetype)
+	query.Set("index", template.Index)
+	if cfg.HECToken != "" && cfg.HECTokenInQuery {
+		query.Set(hecTokenQueryKey, cfg.HECToken)
 	}
-	return json.Marshal(event)
+	epUrl.RawQuery = query.Encode()
+	return epUrl.String()
 }
 
-func buildURL(isRawEvent bool, host, source, sourcetype, index string) (string, error) {
-	epHost := os.Getenv(epHostEnvKey)
-	if epHost == "" {
-		return "", fmt.Errorf("%s has not been provided", epHostEnvKey)
-	}
-
-	parsedHostUrl, err := url.Parse(epHost)
+// redactURL hides the HEC token from urls so they can be logged safely.
+func redactURL(epUrl string) string {
+	parsedUrl, err := url.Parse(epUrl)
 	if err != nil {
-		return "", err
+		return epUrl
 	}
 
-	if !isRawEvent {
-		parsedHostUrl.Path = formattedEndpointSuffix
-		return parsedHostUrl.String(), nil
+	query := parsedUrl.Query()
+	if !query.Has(hecTokenQueryKey) {
+		return epUrl
 	}
-
-	parsedHostUrl.Path = rawEndpointSuffix
-	query := parsedHostUrl.Query()
-	query.Set("host", host)
-	query.Set("source", source)
-	query.Set("sourcetype", sourcetype)
-	query.Set("index", index)
-	parsedHostUrl.RawQuery = query.Encode()
-	return parsedHostUrl.String(), nil
+	query.Set(hecTokenQueryKey, redactedValue)
+	parsedUrl.RawQuery = query.Encode()
+	return parsedUrl.String()
 }
 
-func buildHTTPReq(record events.S3EventRecord, s3Content string) (*http.Request, error) {
-	host, err := os.Hostname()
+func compressGzip(content []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, level)
 	if err != nil {
-		host = defaultHostName
+		return nil, err
 	}
-	isRawEvent := strings.ToLower(os.Getenv(eventIsRawEnvKey)) == "true"
-	sourcetype := getEnvValueOrDefault(sourcetypeEnvKey, defaultSourcetype)
-	index := getEnvValueOrDefault(indexEnvKey, defaultIndex)
-
-	epUrl, err := buildURL(isRawEvent, host, record.EventSource, sourcetype, index)
-	if err != nil {
+	if _, err = writer.Write(content); err != nil {
 		return nil, err
 	}
-
-	postBodyBytes, err := buildPostBody(isRawEvent, record, host, sourcetype, index, s3Content)
-	if err != nil {
+	if err = writer.Close(); err != nil {
 		return nil, err
 	}
+	return buf.Bytes(), nil
+}
+
+// buildPayloadBuilder builds the payload builder of the record object. Events are stamped with the object
+// lastModified time, or the record event time if not known, unless their timestamp is extracted.
+func buildPayloadBuilder(cfg *Config, record events.S3EventRecord, decoder eventDecoder, lastModified time.Time) *hecPayloadBuilder {
+	eventTime := lastModified
+	if eventTime.IsZero() {
+		eventTime = record.EventTime
+	}
+	variables := keyVariables(record.S3.Bucket.Name, getObjectKey(record), cfg.KeyPattern, cfg.RuleKeyRegex)
+	template := hecEvent{
+		Time:       hecTime(eventTime),
+		Host:       renderKeyTemplate(cfg.Host, variables),
+		Source:     renderKeyTemplate(cfg.Source, variables),
+		Sourcetype: renderKeyTemplate(cfg.Sourcetype, variables),
+		Index:      cfg.Index,
+		Fields:     cfg.Fields,
+	}
+
+	return &hecPayloadBuilder{
+		epUrl:        buildURL(cfg, template),
+		isRawEvent:   cfg.IsRawEvent,
+		template:     template,
+		decoder:      decoder,
+		timestamps:   buildTimestampExtractor(cfg),
+		maxEventSize: cfg.MaxEventSize,
+	}
+}
+
+func buildHTTPReq(cfg *Config, epUrl string, postBodyBytes []byte) (*http.Request, error) {
+	if cfg.EncodingMethod == gzipEncoding {
+		var err error
+		postBodyBytes, err = compressGzip(postBodyBytes, cfg.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	req, err := http.NewRequest(http.MethodPost, epUrl, bytes.NewBuffer(postBodyBytes))
+	req, err := http.NewRequest(http.MethodPost, epUrl, bytes.NewReader(postBodyBytes))
 	if err != nil {
 		return nil, err
 	}
 
-	encodingMethod := strings.ToLower(os.Getenv(encodingMethodEnvKey))
-	if encodingMethod != "" {
-		if encodingMethod != gzipEncoding {
-			return nil, fmt.Errorf("%s is not supported. Only gzip is supported", encodingMethod)
-		}
-		req.Header.Set(httpContentEncodingHeader, encodingMethod)
+	if cfg.EncodingMethod != "" {
+		req.Header.Set(httpContentEncodingHeader, cfg.EncodingMethod)
 	}
 	req.Header.Set(httpContentTypeHeader, contentType)
+	if cfg.HECToken != "" {
+		req.Header.Set(httpAuthorizationHeader, hecAuthorizationScheme+cfg.HECToken)
+	}
 
 	return req, nil
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	cloudFrontLogOutputEnvKey = "CLOUDFRONT_LOG_OUTPUT"
+
+	cloudFrontSourcetype = "aws:cloudfront:accesslogs"
+
+	cloudFrontCommentPrefix = "#"
+	cloudFrontFieldsPrefix  = "#Fields:"
+	cloudFrontDateField     = "date"
+	cloudFrontTimeField     = "time"
+	// cloudFrontTimeLayout is the layout of the date and time fields, which are in UTC
+	cloudFrontTimeLayout = "2006-01-02 15:04:05"
+)
+
+// cloudFrontKeyRegex matches the keys of CloudFront standard log files:
+// [prefix/]distribution-id.yyyy-mm-dd-hh.unique-id.gz
+var cloudFrontKeyRegex = regexp.MustCompile(`(^|/)E[A-Z0-9]+\.\d{4}-\d{2}-\d{2}-\d{2}\.[0-9a-z]+(\.gz)?$`)
+
+// cloudFrontDefaultFieldNames are the fields of standard log files, in their order in files without
+// a #Fields header.
+var cloudFrontDefaultFieldNames = []string{
+	"date", "time", "x-edge-location", "sc-bytes", "c-ip", "cs-method", "cs(Host)", "cs-uri-stem", "sc-status",
+	"cs(Referer)", "cs(User-Agent)", "cs-uri-query", "cs(Cookie)", "x-edge-result-type", "x-edge-request-id",
+	"x-host-header", "cs-protocol", "cs-bytes", "time-taken", "x-forwarded-for", "ssl-protocol", "ssl-cipher",
+	"x-edge-response-result-type", "cs-protocol-version", "fle-status", "fle-encrypted-fields", "c-port",
+	"time-to-first-byte", "x-edge-detailed-result-type", "sc-content-type", "sc-content-len", "sc-range-start",
+	"sc-range-end",
+}
+
+// cloudFrontFieldNameReplacer names fields such as cs(User-Agent) cs_user_agent.
+var cloudFrontFieldNameReplacer = strings.NewReplacer("-", "_", "(", "_", ")", "")
+
+// cloudFrontLogDecoder emits each request of a CloudFront standard log file as an event. Files are in
+// the W3C format: tab separated fields listed by the #Fields header, and the time of the request in the
+// date and time fields. Other comment lines such as #Version are skipped.
+type cloudFrontLogDecoder struct {
+	output       string
+	maxEventSize int
+}
+
+func (d *cloudFrontLogDecoder) decode(reader io.Reader, emit func(event decodedEvent) error) error {
+	fieldNames := normalizeCloudFrontFieldNames(cloudFrontDefaultFieldNames)
+	return decodeLines(reader, d.maxEventSize, func(line string) error {
+		if fieldsStr, isFields := strings.CutPrefix(line, cloudFrontFieldsPrefix); isFields {
+			fieldNames = normalizeCloudFrontFieldNames(strings.Fields(fieldsStr))
+			return nil
+		}
+		if strings.HasPrefix(line, cloudFrontCommentPrefix) {
+			return nil
+		}
+		return emit(d.buildEvent(line, fieldNames, strings.Split(line, "\t")))
+	})
+}
+
+func (d *cloudFrontLogDecoder) buildEvent(line string, fieldNames, values []string) decodedEvent {
+	event := buildRecordEvent(d.output, line, fieldNames, values)
+	var date, timeOfDay string
+	for i, name := range fieldNames {
+		if i >= len(values) {
+			break
+		}
+		switch name {
+		case cloudFrontDateField:
+			date = values[i]
+		case cloudFrontTimeField:
+			timeOfDay = values[i]
+		}
+	}
+	if eventTime, err := time.Parse(cloudFrontTimeLayout, date+" "+timeOfDay); err == nil {
+		event.time = eventTime
+	}
+	return event
+}
+
+// normalizeCloudFrontFieldNames names fields in lower snake case, the way of other decoders.
+func normalizeCloudFrontFieldNames(fieldNames []string) []string {
+	normalizedNames := make([]string, len(fieldNames))
+	for i, name := range fieldNames {
+		normalizedNames[i] = strings.ToLower(cloudFrontFieldNameReplacer.Replace(name))
+	}
+	return normalizedNames
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCloudFrontLogFile = "#Version: 1.0\n" +
+	"#Fields: date time x-edge-location sc-bytes c-ip cs-method cs(Host) cs-uri-stem sc-status\n" +
+	"2019-12-04\t21:02:31\tLAX1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/index.html\t200\n" +
+	"2019-12-04\t21:02:32\tLAX1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/favicon.ico\t404\n"
+
+func Test_cloudFrontLogDecoder_decode(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		expectedEvents []decodedEvent
+	}{
+		{
+			name:    "log file",
+			content: testCloudFrontLogFile,
+			expectedEvents: []decodedEvent{
+				{
+					content: "2019-12-04\t21:02:31\tLAX1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/index.html\t200",
+					time:    time.Date(2019, 12, 4, 21, 2, 31, 0, time.UTC),
+				},
+				{
+					content: "2019-12-04\t21:02:32\tLAX1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/favicon.ico\t404",
+					time:    time.Date(2019, 12, 4, 21, 2, 32, 0, time.UTC),
+				},
+			},
+		},
+		{
+			name:    "custom field order",
+			content: "#Fields: c-ip time date\n192.0.2.100\t21:02:31\t2019-12-04\n",
+			expectedEvents: []decodedEvent{
+				{content: "192.0.2.100\t21:02:31\t2019-12-04", time: time.Date(2019, 12, 4, 21, 2, 31, 0, time.UTC)},
+			},
+		},
+		{
+			name:    "no date field",
+			content: "#Fields: time c-ip\n21:02:31\t192.0.2.100\n",
+			expectedEvents: []decodedEvent{
+				{content: "21:02:31\t192.0.2.100"},
+			},
+		},
+		{
+			name:    "no fields header",
+			content: "2019-12-04\t21:02:31\tLAX1\n",
+			expectedEvents: []decodedEvent{
+				{content: "2019-12-04\t21:02:31\tLAX1", time: time.Date(2019, 12, 4, 21, 2, 31, 0, time.UTC)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decodedEvents []decodedEvent
+			err := (&cloudFrontLogDecoder{output: rawRecordOutput, maxEventSize: defaultMaxEventSize}).decode(strings.NewReader(tt.content), func(event decodedEvent) error {
+				decodedEvents = append(decodedEvents, event)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedEvents, decodedEvents)
+		})
+	}
+}
+
+func Test_cloudFrontLogDecoder_decode_namedFields(t *testing.T) {
+	// fields are named by the #Fields header, whatever their order, including fields unknown to the decoder
+	content := "#Fields: c-ip time cs(User-Agent) x-custom date sc-status\n" +
+		"192.0.2.100\t21:02:31\tcurl/8.0\tvalue\t2019-12-04\t-\n"
+	line := "192.0.2.100\t21:02:31\tcurl/8.0\tvalue\t2019-12-04\t-"
+	eventTime := time.Date(2019, 12, 4, 21, 2, 31, 0, time.UTC)
+
+	tests := []struct {
+		output        string
+		expectedEvent decodedEvent
+	}{
+		{
+			output:        rawRecordOutput,
+			expectedEvent: decodedEvent{content: line, time: eventTime},
+		},
+		{
+			output: jsonRecordOutput,
+			expectedEvent: decodedEvent{
+				content: `{"c_ip":"192.0.2.100","time":"21:02:31","cs_user_agent":"curl/8.0","x_custom":"value","date":"2019-12-04"}`,
+				time:    eventTime,
+			},
+		},
+		{
+			output: fieldsRecordOutput,
+			expectedEvent: decodedEvent{
+				content: line,
+				time:    eventTime,
+				fields: map[string]string{
+					"c_ip": "192.0.2.100", "time": "21:02:31", "cs_user_agent": "curl/8.0", "x_custom": "value", "date": "2019-12-04",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			var decodedEvents []decodedEvent
+			err := (&cloudFrontLogDecoder{output: tt.output, maxEventSize: defaultMaxEventSize}).decode(strings.NewReader(content), func(event decodedEvent) error {
+				decodedEvents = append(decodedEvents, event)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []decodedEvent{tt.expectedEvent}, decodedEvents)
+		})
+	}
+}
+
+func Test_cloudFrontLogDecoder_decode_defaultFields_json(t *testing.T) {
+	var decodedEvents []decodedEvent
+	err := (&cloudFrontLogDecoder{output: jsonRecordOutput, maxEventSize: defaultMaxEventSize}).decode(
+		strings.NewReader("2019-12-04\t21:02:31\tLAX1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\n"),
+		func(event decodedEvent) error {
+			decodedEvents = append(decodedEvents, event)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []decodedEvent{{
+		content: `{"date":"2019-12-04","time":"21:02:31","x_edge_location":"LAX1","sc_bytes":"392","c_ip":"192.0.2.100",` +
+			`"cs_method":"GET","cs_host":"d111111abcdef8.cloudfront.net"}`,
+		time: time.Date(2019, 12, 4, 21, 2, 31, 0, time.UTC),
+	}}, decodedEvents)
+}
+
+func Test_cloudFrontLogDecoder_decode_lineBiggerThanMaxEventSize_truncated(t *testing.T) {
+	content := "#Fields: date time c-ip\n2019-12-04\t21:02:31\t" + strings.Repeat("x", 10000) + "\n" +
+		"2019-12-04\t21:02:32\t192.0.2.1\n"
+
+	var decodedEvents []decodedEvent
+	err := (&cloudFrontLogDecoder{output: rawRecordOutput, maxEventSize: 30}).decode(strings.NewReader(content), func(event decodedEvent) error {
+		decodedEvents = append(decodedEvents, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []decodedEvent{
+		{content: "2019-12-04\t21:02:31\txxxxxxxxxx", time: time.Date(2019, 12, 4, 21, 2, 31, 0, time.UTC)},
+		{content: "2019-12-04\t21:02:32\t192.0.2.1", time: time.Date(2019, 12, 4, 21, 2, 32, 0, time.UTC)},
+	}, decodedEvents)
+}
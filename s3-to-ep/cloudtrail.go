@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+const (
+	cloudTrailSourcetype     = "aws:cloudtrail"
+	cloudTrailRecordsKey     = "Records"
+	cloudTrailDigestKeyGroup = "digest"
+)
+
+// cloudTrailKeyRegex matches the keys of CloudTrail log and digest files, including organization trails:
+// [prefix/]AWSLogs/[o-orgid/]account/CloudTrail[-Digest]/region/yyyy/mm/dd/file.json.gz
+var cloudTrailKeyRegex = regexp.MustCompile(`(^|/)AWSLogs/(o-[a-z0-9]+/)?\d{12}/CloudTrail(?P<digest>-Digest)?/`)
+
+// isCloudTrailDigestKey is true for digest files, which only hold hashes to validate log files.
+func isCloudTrailDigestKey(objectKey string) bool {
+	match := cloudTrailKeyRegex.FindStringSubmatch(objectKey)
+	return match != nil && match[cloudTrailKeyRegex.SubexpIndex(cloudTrailDigestKeyGroup)] != ""
+}
+
+// cloudTrailDecoder emits each API call of the Records array of a CloudTrail log file as an event.
+// The file is streamed so only one record is held in memory at a time. Records bigger than maxEventSize
+// fail the file.
+type cloudTrailDecoder struct {
+	maxEventSize int
+}
+
+type cloudTrailRecord struct {
+	EventTime string `json:"eventTime"`
+}
+
+func (d *cloudTrailDecoder) decode(reader io.Reader, emit func(event decodedEvent) error) error {
+	decoder := newSizeLimitedJSONDecoder(reader, d.maxEventSize)
+	if err := expectJSONDelim(decoder.Decoder, '{'); errors.Is(err, io.EOF) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("invalid cloudtrail log file: %w", err)
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("invalid cloudtrail log file: %w", err)
+		}
+		if token != cloudTrailRecordsKey {
+			if _, err = decoder.decodeValue(); err != nil {
+				return fmt.Errorf("invalid cloudtrail log file: %w", err)
+			}
+			continue
+		}
+
+		if err = d.decodeRecords(decoder, emit); err != nil {
+			return err
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("invalid cloudtrail log file: %w", err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("invalid cloudtrail log file: unexpected content after the log file")
+	}
+	return nil
+}
+
+func (d *cloudTrailDecoder) decodeRecords(decoder *sizeLimitedJSONDecoder, emit func(event decodedEvent) error) error {
+	if err := expectJSONDelim(decoder.Decoder, '['); err != nil {
+		return fmt.Errorf("invalid cloudtrail records: %w", err)
+	}
+
+	for decoder.More() {
+		rawRecord, err := decoder.decodeValue()
+		if err != nil {
+			return fmt.Errorf("invalid cloudtrail record: %w", err)
+		}
+
+		event := decodedEvent{content: string(rawRecord)}
+		var record cloudTrailRecord
+		if err := json.Unmarshal(rawRecord, &record); err == nil && record.EventTime != "" {
+			if eventTime, err := time.Parse(time.RFC3339, record.EventTime); err == nil {
+				event.time = eventTime
+			}
+		}
+		if err := emit(event); err != nil {
+			return err
+		}
+	}
+
+	_, err := decoder.Token()
+	return err
+}
+
+// sizeLimitedJSONDecoder decodes values of a JSON stream, failing on values bigger than maxEventSize
+// before they are held in memory as a whole.
+type sizeLimitedJSONDecoder struct {
+	*json.Decoder
+	reader *sizeLimitedJSONReader
+}
+
+func newSizeLimitedJSONDecoder(reader io.Reader, maxEventSize int) *sizeLimitedJSONDecoder {
+	limitedReader := &sizeLimitedJSONReader{reader: reader, maxEventSize: maxEventSize}
+	return &sizeLimitedJSONDecoder{Decoder: json.NewDecoder(limitedReader), reader: limitedReader}
+}
+
+// decodeValue returns the text of the next value.
+func (d *sizeLimitedJSONDecoder) decodeValue() (json.RawMessage, error) {
+	d.reader.read = 0
+	var value json.RawMessage
+	if err := d.Decode(&value); err != nil {
+		return nil, err
+	}
+	if len(value) > d.reader.maxEventSize {
+		return nil, jsonValueSizeError(d.reader.maxEventSize)
+	}
+	return value, nil
+}
+
+// sizeLimitedJSONReader fails once more than twice maxEventSize bytes are read since read was reset.
+// The decoder buffers the whitespace around a value and reads ahead of it, so a value may need more
+// than maxEventSize bytes to be read.
+type sizeLimitedJSONReader struct {
+	reader       io.Reader
+	maxEventSize int
+	read         int
+}
+
+func (r *sizeLimitedJSONReader) Read(p []byte) (int, error) {
+	remaining := 2*r.maxEventSize - r.read
+	if remaining <= 0 {
+		return 0, jsonValueSizeError(r.maxEventSize)
+	}
+	if len(p) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+func jsonValueSizeError(maxEventSize int) error {
+	return fmt.Errorf("JSON value is bigger than %s of %d bytes", maxEventSizeEnvKey, maxEventSize)
+}
+
+// expectJSONDelim reads the next token, which must be delim.
+func expectJSONDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return errors.New("expected " + delim.String())
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCloudTrailLogFile = `{"Records":[` +
+	`{"eventVersion":"1.08","eventTime":"2023-06-01T12:00:00Z","eventSource":"s3.amazonaws.com","eventName":"GetObject"},` +
+	`{"eventVersion":"1.08","eventTime":"2023-06-01T12:00:01Z","eventSource":"iam.amazonaws.com","eventName":"ListRoles"}` +
+	`]}`
+
+func Test_cloudTrailDecoder_decode(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		expectedEvents []decodedEvent
+		expectedErr    bool
+	}{
+		{
+			name:    "log file",
+			content: testCloudTrailLogFile,
+			expectedEvents: []decodedEvent{
+				{
+					content: `{"eventVersion":"1.08","eventTime":"2023-06-01T12:00:00Z","eventSource":"s3.amazonaws.com","eventName":"GetObject"}`,
+					time:    time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+				},
+				{
+					content: `{"eventVersion":"1.08","eventTime":"2023-06-01T12:00:01Z","eventSource":"iam.amazonaws.com","eventName":"ListRoles"}`,
+					time:    time.Date(2023, 6, 1, 12, 0, 1, 0, time.UTC),
+				},
+			},
+		},
+		{
+			name:    "other keys and record without time",
+			content: `{"version": {"a": [1, 2]}, "Records": [{"eventName": "GetObject"}], "count": 1}`,
+			expectedEvents: []decodedEvent{
+				{content: `{"eventName": "GetObject"}`},
+			},
+		},
+		{
+			name:    "empty file",
+			content: "",
+		},
+		{
+			name:        "not a cloudtrail log file",
+			content:     `[{"eventName": "GetObject"}]`,
+			expectedErr: true,
+		},
+		{
+			name:        "truncated log file",
+			content:     `{"Records": [{"eventName": "GetObject"}, {"event`,
+			expectedErr: true,
+		},
+		{
+			name:        "log file without closing brace",
+			content:     `{"Records": [{"eventName": "GetObject"}]`,
+			expectedErr: true,
+		},
+		{
+			name:    "trailing whitespace",
+			content: "{\"Records\": [{\"eventName\": \"GetObject\"}]}\n\n",
+			expectedEvents: []decodedEvent{
+				{content: `{"eventName": "GetObject"}`},
+			},
+		},
+		{
+			name:        "trailing content",
+			content:     `{"Records": [{"eventName": "GetObject"}]} garbage`,
+			expectedErr: true,
+		},
+		{
+			name:        "concatenated log files",
+			content:     `{"Records": [{"eventName": "GetObject"}]}{"Records": []}`,
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decodedEvents []decodedEvent
+			err := (&cloudTrailDecoder{maxEventSize: defaultMaxEventSize}).decode(strings.NewReader(tt.content), func(event decodedEvent) error {
+				decodedEvents = append(decodedEvents, event)
+				return nil
+			})
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedEvents, decodedEvents)
+		})
+	}
+}
+
+func Test_cloudTrailDecoder_decode_recordBiggerThanMaxEventSize_error(t *testing.T) {
+	// records slightly bigger than MAX_EVENT_SIZE are read whole, bigger ones are not
+	for _, size := range []int{101, 10000} {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			content := `{"Records": [{"eventName": "GetObject"}, {"eventName": "` + strings.Repeat("x", size-17) + `"}]}`
+
+			var decodedEvents []decodedEvent
+			err := (&cloudTrailDecoder{maxEventSize: 100}).decode(strings.NewReader(content), func(event decodedEvent) error {
+				decodedEvents = append(decodedEvents, event)
+				return nil
+			})
+			assert.ErrorContains(t, err, "JSON value is bigger than MAX_EVENT_SIZE of 100 bytes")
+			assert.Equal(t, []decodedEvent{{content: `{"eventName": "GetObject"}`}}, decodedEvents)
+		})
+	}
+}
+
+func Test_detectDecoderName(t *testing.T) {
+	tests := []struct {
+		key                 string
+		expectedDecoderName string
+		expectedDigest      bool
+	}{
+		{
+			key:                 "AWSLogs/123456789012/CloudTrail/us-west-2/2023/06/01/123456789012_CloudTrail_us-west-2_20230601T1200Z_abc.json.gz",
+			expectedDecoderName: cloudTrailDecoderName,
+		},
+		{
+			key:                 "prefix/AWSLogs/o-abc123def4/123456789012/CloudTrail/us-west-2/2023/06/01/file.json.gz",
+			expectedDecoderName: cloudTrailDecoderName,
+		},
+		{
+			key:                 "AWSLogs/123456789012/CloudTrail-Digest/us-west-2/2023/06/01/file.json.gz",
+			expectedDecoderName: cloudTrailDecoderName,
+			expectedDigest:      true,
+		},
+		{
+			key:                 "AWSLogs/123456789012/vpcflowlogs/us-west-2/2023/06/01/123456789012_vpcflowlogs_us-west-2_fl-1234abcd_20230601T1200Z_abc.log.gz",
+			expectedDecoderName: vpcFlowLogDecoderName,
+		},
+		{
+			key:                 "prefix/AWSLogs/aws-account-id=123456789012/aws-service=vpcflowlogs/aws-region=us-west-2/year=2023/month=06/day=01/file.log.parquet",
+			expectedDecoderName: vpcFlowLogDecoderName,
+		},
+		{
+			key:                 "AWSLogs/123456789012/elasticloadbalancing/us-east-2/2018/07/02/file.log.gz",
+			expectedDecoderName: elbDecoderName,
+		},
+		{
+			key:                 "cloudfront/E2EXAMPLE1ABC.2019-12-04-21.a1b2c3d4.gz",
+			expectedDecoderName: cloudFrontDecoderName,
+		},
+		{
+			key:                 "s3-logs/2019-02-06-00-00-38-5A3D9F8B2C1E4D7A",
+			expectedDecoderName: s3AccessLogDecoderName,
+		},
+		{
+			key:                 "logs/2019-02-06-00-00-38-app.log",
+			expectedDecoderName: lineDecoderName,
+		},
+		{
+			key:                 "ext/source/region=us-east-1/accountId=123456789012/eventDay=20230601/file.gz.parquet",
+			expectedDecoderName: parquetDecoderName,
+		},
+		{
+			key:                 "logs/CloudTrail/file.json.gz",
+			expectedDecoderName: lineDecoderName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			assert.Equal(t, tt.expectedDecoderName, detectDecoderName(tt.key))
+			assert.Equal(t, tt.expectedDigest, isCloudTrailDigestKey(tt.key))
+		})
+	}
+}
+
+func Test_recordsProcessor_process_cloudTrail(t *testing.T) {
+	const (
+		logKey    = "AWSLogs/123456789012/CloudTrail/us-west-2/2023/06/01/file.json.gz"
+		digestKey = "AWSLogs/123456789012/CloudTrail-Digest/us-west-2/2023/06/01/file.json.gz"
+	)
+	assert.NoError(t, os.Setenv(routingRulesEnvKey, `[{"key_prefix": "trails/", "decoder": "cloudtrail", "index": "trails"}]`))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(routingRulesEnvKey)
+	})
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var hecEvents []hecEvent
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost"+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		decoder := json.NewDecoder(req.Body)
+		for decoder.More() {
+			var event hecEvent
+			assert.NoError(t, decoder.Decode(&event))
+			hecEvents = append(hecEvents, event)
+		}
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	s3Client := &objectsTestS3Client{
+		objects: map[string]string{
+			logKey:             testCloudTrailLogFile,
+			"trails/file.json": testCloudTrailLogFile,
+			"logs/app.log":     "line-1\nline-2",
+		},
+	}
+	h := newHandler(buildTestConfig(t), s3Client, &http.Client{}, &mapTestSecretsManagerClient{})
+	h.processor.concurrency = 1
+
+	errs := h.processor.process(context.Background(), []events.S3EventRecord{
+		buildTestRecord(logKey),
+		buildTestRecord(digestKey),
+		buildTestRecord("trails/file.json"),
+		buildTestRecord("logs/app.log"),
+	})
+	assert.Equal(t, []error{nil, nil, nil, nil}, errs)
+	// digest files aren't fetched
+	assert.NotContains(t, s3Client.fetchedKeys, digestKey)
+
+	assert.Len(t, hecEvents, 6)
+	for _, event := range hecEvents[:4] {
+		assert.Equal(t, cloudTrailSourcetype, event.Sourcetype)
+	}
+	assert.Equal(t, float64(1685620800), hecEvents[0].Time)
+	assert.Equal(t, float64(1685620801), hecEvents[1].Time)
+	assert.Equal(t, defaultIndex, hecEvents[0].Index)
+	assert.Equal(t, "trails", hecEvents[2].Index)
+	assert.Equal(t, defaultSourcetype, hecEvents[4].Sourcetype)
+	assert.Equal(t, "line-1", hecEvents[4].Event)
+}
@@ -1,13 +1,64 @@
 package main
 
 import (
-	"os"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
 )
 
-func getEnvValueOrDefault(key string, defaultVal string) string {
-	val := os.Getenv(key)
+func getEnvValueOrDefault(getenv func(string) string, key string, defaultVal string) string {
+	val := getenv(key)
 	if val == "" {
 		val = defaultVal
 	}
 	return val
 }
+
+func getPositiveIntEnvValueOrDefault(getenv func(string) string, key string, defaultVal int) (int, error) {
+	valStr := getenv(key)
+	if valStr == "" {
+		return defaultVal, nil
+	}
+
+	val, err := strconv.Atoi(valStr)
+	if err != nil || val <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", key)
+	}
+	return val, nil
+}
+
+func getPositiveDurationEnvValueOrDefault(getenv func(string) string, key string, defaultVal time.Duration) (time.Duration, error) {
+	valStr := getenv(key)
+	if valStr == "" {
+		return defaultVal, nil
+	}
+
+	val, err := time.ParseDuration(valStr)
+	if err != nil || val <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration", key)
+	}
+	return val, nil
+}
+
+// getBoolEnvValue returns false if the env isn't set.
+func getBoolEnvValue(getenv func(string) string, key string) (bool, error) {
+	valStr := getenv(key)
+	if valStr == "" {
+		return false, nil
+	}
+
+	val, err := strconv.ParseBool(valStr)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", key)
+	}
+	return val, nil
+}
+
+func getRegexpEnvValueOrDefault(getenv func(string) string, key string, defaultVal string) (*regexp.Regexp, error) {
+	val, err := regexp.Compile(getEnvValueOrDefault(getenv, key, defaultVal))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid regex: %w", key, err)
+	}
+	return val, nil
+}
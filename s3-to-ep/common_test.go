@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -13,7 +14,7 @@ func Test_getEnvValueOrDefault_noEnvSet_useDefault(t *testing.T) {
 		defaultVal = "defaultVal"
 	)
 	_ = os.Unsetenv(testKey)
-	val := getEnvValueOrDefault(testKey, defaultVal)
+	val := getEnvValueOrDefault(os.Getenv, testKey, defaultVal)
 	assert.Equal(t, defaultVal, val)
 }
 
@@ -28,6 +29,108 @@ func Test_getEnvValueOrDefault_hasEnvSet_getEnvVal(t *testing.T) {
 		_ = os.Unsetenv(testKey)
 	})
 
-	val := getEnvValueOrDefault(testKey, defaultVal)
+	val := getEnvValueOrDefault(os.Getenv, testKey, defaultVal)
 	assert.Equal(t, testEnvVal, val)
 }
+
+func Test_getPositiveIntEnvValueOrDefault(t *testing.T) {
+	const (
+		testKey    = "test_key"
+		defaultVal = 10
+	)
+
+	tests := []struct {
+		name        string
+		envVal      string
+		expectedVal int
+		expectedErr bool
+	}{
+		{
+			name:        "no env set uses default",
+			expectedVal: defaultVal,
+		},
+		{
+			name:        "env set uses env value",
+			envVal:      "5",
+			expectedVal: 5,
+		},
+		{
+			name:        "env is not a number",
+			envVal:      "five",
+			expectedErr: true,
+		},
+		{
+			name:        "env is zero",
+			envVal:      "0",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, os.Setenv(testKey, tt.envVal))
+			t.Cleanup(func() {
+				_ = os.Unsetenv(testKey)
+			})
+
+			val, err := getPositiveIntEnvValueOrDefault(os.Getenv, testKey, defaultVal)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedVal, val)
+		})
+	}
+}
+
+func Test_getPositiveDurationEnvValueOrDefault(t *testing.T) {
+	const (
+		testKey    = "test_key"
+		defaultVal = time.Second
+	)
+
+	tests := []struct {
+		name        string
+		envVal      string
+		expectedVal time.Duration
+		expectedErr bool
+	}{
+		{
+			name:        "no env set uses default",
+			expectedVal: defaultVal,
+		},
+		{
+			name:        "env set uses env value",
+			envVal:      "250ms",
+			expectedVal: 250 * time.Millisecond,
+		},
+		{
+			name:        "env is not a duration",
+			envVal:      "250",
+			expectedErr: true,
+		},
+		{
+			name:        "env is negative",
+			envVal:      "-1s",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, os.Setenv(testKey, tt.envVal))
+			t.Cleanup(func() {
+				_ = os.Unsetenv(testKey)
+			})
+
+			val, err := getPositiveDurationEnvValueOrDefault(os.Getenv, testKey, defaultVal)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedVal, val)
+		})
+	}
+}
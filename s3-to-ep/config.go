@@ -0,0 +1,291 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of the lambda. It is loaded and validated once at cold start
+// so misconfigurations are reported before any record is processed.
+type Config struct {
+	// EP connection
+	EPHost                *url.URL
+	TLSCertificate        *tls.Certificate
+	TLSRootCAs            *x509.CertPool
+	TLSServerName         string
+	TLSMinVersion         uint16
+	TLSCipherSuites       []uint16
+	TLSInsecureSkipVerify bool
+	EncodingMethod        string
+	CompressionLevel      int
+	HECToken              string
+	HECTokenInQuery       bool
+
+	// values stored in Secrets Manager, resolved at each invocation
+	TLSClientCertSecretARN string
+	TLSClientKeySecretARN  string
+	TLSCACertSecretARN     string
+	HECTokenSecretARN      string
+	SecretsCacheTTL        time.Duration
+
+	// HEC event metadata
+	Sourcetype string
+	// SourcetypeSet is true if Sourcetype was set with EVENT_SOURCETYPE or a routing rule, even to the
+	// default value, so decoders don't replace it
+	SourcetypeSet bool
+	Index         string
+	IsRawEvent    bool
+	Fields        map[string]string
+	// Sourcetype, Source and Host are templates rendered with the variables of each object
+	Source     string
+	Host       string
+	KeyPattern *regexp.Regexp
+	// RuleKeyRegex is the key_regex of the routing rule matching the object, if any
+	RuleKeyRegex *regexp.Regexp
+
+	RoutingRules []routingRule
+
+	// Decoder is resolved for each object by routing
+	Decoder             string
+	VPCFlowLogOutput    string
+	ELBLogOutput        string
+	CloudFrontLogOutput string
+	// ParquetTimestampColumn is the dot separated path of the column holding the time of Parquet rows
+	ParquetTimestampColumn string
+	// JSON documents: the path of the array of events and the keys lifted into the event metadata
+	JSONArrayPath     []string
+	JSONHostKey       []string
+	JSONSourceKey     []string
+	JSONSourcetypeKey []string
+	JSONTimeKey       []string
+	JSONFieldKeys     map[string][]string
+
+	// timestamp extraction
+	TimestampField        []string
+	TimestampRegex        *regexp.Regexp
+	TimestampLayout       string
+	TimestampLocation     *time.Location
+	TimestampMaxLookahead int
+
+	// line breaking
+	LineBreaker     *regexp.Regexp
+	ShouldLineMerge bool
+	BreakOnlyBefore *regexp.Regexp
+	MaxEventSize    int
+
+	// batching and retries
+	BatchMaxBytes    int
+	BatchMaxEvents   int
+	BatchMaxLinger   time.Duration
+	RetryMaxAttempts int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+
+	MaxConcurrency int
+}
+
+// loadConfig reads the configuration with getenv. All invalid values are reported together in the error.
+func loadConfig(getenv func(key string) string) (*Config, error) {
+	cfg := &Config{
+		HECToken:      getenv(hecTokenEnvKey),
+		TLSServerName: getenv(tlsServerNameEnvKey),
+		Sourcetype:    getEnvValueOrDefault(getenv, sourcetypeEnvKey, defaultSourcetype),
+		SourcetypeSet: getenv(sourcetypeEnvKey) != "",
+		Index:         getEnvValueOrDefault(getenv, indexEnvKey, defaultIndex),
+		Source:        getEnvValueOrDefault(getenv, sourceEnvKey, defaultSource),
+		Host:          getEnvValueOrDefault(getenv, hostEnvKey, defaultHost),
+
+		ParquetTimestampColumn: getenv(parquetTimestampColumnEnvKey),
+	}
+
+	var errs []error
+	var err error
+	cfg.EPHost, err = parseEPHost(epHostEnvKey, getenv(epHostEnvKey))
+	errs = append(errs, err)
+	cfg.TLSCertificate, err = parseTLSCertificate(getenv(epTLSClientCertEnvKey), getenv(epTLSClientPrivateKeyEnvKey))
+	errs = append(errs, err)
+	cfg.TLSRootCAs, err = parseTLSRootCAs(getenv(epTLSCACertEnvKey))
+	errs = append(errs, err)
+	cfg.TLSMinVersion, err = parseTLSMinVersion(getenv(tlsMinVersionEnvKey))
+	errs = append(errs, err)
+	cfg.TLSCipherSuites, err = parseTLSCipherSuites(getenv(tlsCipherSuitesEnvKey))
+	errs = append(errs, err)
+	cfg.TLSInsecureSkipVerify, err = getBoolEnvValue(getenv, tlsInsecureSkipVerifyEnvKey)
+	errs = append(errs, err)
+	cfg.EncodingMethod, err = parseEncodingMethod(getenv(encodingMethodEnvKey))
+	errs = append(errs, err)
+	cfg.CompressionLevel, err = parseCompressionLevel(getenv(compressionLevelEnvKey))
+	errs = append(errs, err)
+	cfg.HECTokenInQuery, err = getBoolEnvValue(getenv, hecTokenInQueryEnvKey)
+	errs = append(errs, err)
+
+	cfg.TLSClientCertSecretARN, err = parseSecretARN(epTLSClientCertSecretEnvKey, getenv(epTLSClientCertSecretEnvKey))
+	errs = append(errs, err)
+	cfg.TLSClientKeySecretARN, err = parseSecretARN(epTLSClientPrivateKeySecretEnvKey, getenv(epTLSClientPrivateKeySecretEnvKey))
+	errs = append(errs, err)
+	cfg.TLSCACertSecretARN, err = parseSecretARN(epTLSCACertSecretEnvKey, getenv(epTLSCACertSecretEnvKey))
+	errs = append(errs, err)
+	cfg.HECTokenSecretARN, err = parseSecretARN(hecTokenSecretEnvKey, getenv(hecTokenSecretEnvKey))
+	errs = append(errs, err)
+	cfg.SecretsCacheTTL, err = getPositiveDurationEnvValueOrDefault(getenv, secretsCacheTTLEnvKey, defaultSecretsCacheTTL)
+	errs = append(errs, err)
+	errs = append(errs, validateSecretARNs(getenv, cfg))
+
+	cfg.IsRawEvent, err = getBoolEnvValue(getenv, eventIsRawEnvKey)
+	errs = append(errs, err)
+	cfg.Fields, err = parseFields(getenv(fieldsEnvKey))
+	errs = append(errs, err)
+	cfg.Decoder, err = parseDecoderName(decoderEnvKey, getenv(decoderEnvKey))
+	errs = append(errs, err)
+	cfg.VPCFlowLogOutput, err = parseRecordOutput(vpcFlowLogOutputEnvKey, getenv(vpcFlowLogOutputEnvKey))
+	errs = append(errs, err)
+	cfg.ELBLogOutput, err = parseRecordOutput(elbLogOutputEnvKey, getenv(elbLogOutputEnvKey))
+	errs = append(errs, err)
+	cfg.CloudFrontLogOutput, err = parseRecordOutput(cloudFrontLogOutputEnvKey, getenv(cloudFrontLogOutputEnvKey))
+	errs = append(errs, err)
+	cfg.JSONArrayPath, err = parseJSONPath(jsonArrayPathEnvKey, getenv(jsonArrayPathEnvKey))
+	errs = append(errs, err)
+	cfg.JSONHostKey, err = parseJSONPath(jsonHostKeyEnvKey, getenv(jsonHostKeyEnvKey))
+	errs = append(errs, err)
+	cfg.JSONSourceKey, err = parseJSONPath(jsonSourceKeyEnvKey, getenv(jsonSourceKeyEnvKey))
+	errs = append(errs, err)
+	cfg.JSONSourcetypeKey, err = parseJSONPath(jsonSourcetypeKeyEnvKey, getenv(jsonSourcetypeKeyEnvKey))
+	errs = append(errs, err)
+	cfg.JSONTimeKey, err = parseJSONPath(jsonTimeKeyEnvKey, getenv(jsonTimeKeyEnvKey))
+	errs = append(errs, err)
+	cfg.JSONFieldKeys, err = parseJSONFieldKeys(getenv(jsonFieldKeysEnvKey))
+	errs = append(errs, err)
+	cfg.KeyPattern, err = parseKeyPattern(getenv(keyPatternEnvKey), getenv(keyRegexEnvKey))
+	errs = append(errs, err)
+	errs = append(errs, validateKeyTemplate(sourcetypeEnvKey, cfg.Sourcetype, cfg.KeyPattern))
+	errs = append(errs, validateKeyTemplate(sourceEnvKey, cfg.Source, cfg.KeyPattern))
+	errs = append(errs, validateKeyTemplate(hostEnvKey, cfg.Host, cfg.KeyPattern))
+	cfg.RoutingRules, err = parseRoutingRules(getenv(routingRulesEnvKey), cfg.KeyPattern)
+	errs = append(errs, err)
+
+	cfg.TimestampField = parseTimestampField(getenv(timestampFieldEnvKey))
+	if timestampRegex := getenv(timestampRegexEnvKey); timestampRegex != "" {
+		cfg.TimestampRegex, err = getRegexpEnvValueOrDefault(getenv, timestampRegexEnvKey, "")
+		errs = append(errs, err)
+		if cfg.TimestampField != nil {
+			errs = append(errs, fmt.Errorf("only one of %s and %s can be set", timestampFieldEnvKey, timestampRegexEnvKey))
+		}
+	}
+	cfg.TimestampLayout, err = parseTimestampFormat(getenv(timestampFormatEnvKey))
+	errs = append(errs, err)
+	cfg.TimestampLocation, err = parseTimestampTimezone(getenv(timestampTimezoneEnvKey))
+	errs = append(errs, err)
+	cfg.TimestampMaxLookahead, err = getPositiveIntEnvValueOrDefault(getenv, timestampMaxLookaheadEnvKey, defaultTimestampMaxLookahead)
+	errs = append(errs, err)
+
+	cfg.LineBreaker, err = getRegexpEnvValueOrDefault(getenv, lineBreakerEnvKey, defaultLineBreaker)
+	errs = append(errs, err)
+	cfg.ShouldLineMerge, err = getBoolEnvValue(getenv, shouldLineMergeEnvKey)
+	errs = append(errs, err)
+	cfg.BreakOnlyBefore, err = getRegexpEnvValueOrDefault(getenv, breakOnlyBeforeEnvKey, defaultBreakOnlyBefore)
+	errs = append(errs, err)
+	cfg.MaxEventSize, err = getPositiveIntEnvValueOrDefault(getenv, maxEventSizeEnvKey, defaultMaxEventSize)
+	errs = append(errs, err)
+
+	cfg.BatchMaxBytes, err = getPositiveIntEnvValueOrDefault(getenv, batchMaxBytesEnvKey, defaultBatchMaxBytes)
+	errs = append(errs, err)
+	cfg.BatchMaxEvents, err = getPositiveIntEnvValueOrDefault(getenv, batchMaxEventsEnvKey, defaultBatchMaxEvents)
+	errs = append(errs, err)
+	cfg.BatchMaxLinger, err = getPositiveDurationEnvValueOrDefault(getenv, batchMaxLingerEnvKey, defaultBatchMaxLinger)
+	errs = append(errs, err)
+	cfg.RetryMaxAttempts, err = getPositiveIntEnvValueOrDefault(getenv, retryMaxAttemptsEnvKey, defaultRetryMaxAttempts)
+	errs = append(errs, err)
+	cfg.RetryBaseDelay, err = getPositiveDurationEnvValueOrDefault(getenv, retryBaseDelayEnvKey, defaultRetryBaseDelay)
+	errs = append(errs, err)
+	cfg.RetryMaxDelay, err = getPositiveDurationEnvValueOrDefault(getenv, retryMaxDelayEnvKey, defaultRetryMaxDelay)
+	errs = append(errs, err)
+
+	cfg.MaxConcurrency, err = getPositiveIntEnvValueOrDefault(getenv, maxConcurrencyEnvKey, defaultMaxConcurrency)
+	errs = append(errs, err)
+
+	if err = errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parseEPHost parses the EP host set in key.
+func parseEPHost(key, epHost string) (*url.URL, error) {
+	if epHost == "" {
+		return nil, fmt.Errorf("%s has not been provided", key)
+	}
+
+	parsedHostUrl, err := url.Parse(epHost)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid url: %w", key, err)
+	}
+	if (parsedHostUrl.Scheme != "http" && parsedHostUrl.Scheme != "https") || parsedHostUrl.Host == "" {
+		return nil, fmt.Errorf("%s must be an http or https url including the host, got %q", key, epHost)
+	}
+	return parsedHostUrl, nil
+}
+
+// parseTLSCertificate returns nil if the client certificate or key isn't provided. A certificate without
+// its key, or the reverse, is logged as it's most likely a misconfiguration.
+func parseTLSCertificate(clientCert, clientKey string) (*tls.Certificate, error) {
+	if clientCert == "" || clientKey == "" {
+		if clientCert != "" || clientKey != "" {
+			log.Printf("WARNING: only one of %s and %s is set. No client certificate is sent to EP", epTLSClientCertEnvKey, epTLSClientPrivateKeyEnvKey)
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+	if err != nil {
+		return nil, fmt.Errorf("%s and %s are not a valid PEM key pair: %w", epTLSClientCertEnvKey, epTLSClientPrivateKeyEnvKey, err)
+	}
+	return &cert, nil
+}
+
+// parseTLSRootCAs adds the CA certificate to the system cert pool. It returns nil if no CA certificate is provided.
+func parseTLSRootCAs(caCert string) (*x509.CertPool, error) {
+	if caCert == "" {
+		return nil, nil
+	}
+
+	certPool, err := x509.SystemCertPool()
+	if err != nil {
+		certPool = x509.NewCertPool()
+	}
+	if !certPool.AppendCertsFromPEM([]byte(caCert)) {
+		return nil, fmt.Errorf("%s doesn't contain any valid PEM certificate", epTLSCACertEnvKey)
+	}
+	return certPool, nil
+}
+
+func parseEncodingMethod(encodingMethod string) (string, error) {
+	encodingMethod = strings.ToLower(encodingMethod)
+	if encodingMethod != "" && encodingMethod != gzipEncoding {
+		return "", fmt.Errorf("%s %s is not supported. Only GZIP is supported", encodingMethodEnvKey, encodingMethod)
+	}
+	return encodingMethod, nil
+}
+
+func parseCompressionLevel(levelStr string) (int, error) {
+	if levelStr == "" {
+		return gzip.DefaultCompression, nil
+	}
+
+	level, err := strconv.Atoi(levelStr)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %w", compressionLevelEnvKey, err)
+	}
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return 0, fmt.Errorf("%s must be between %d and %d", compressionLevelEnvKey, gzip.HuffmanOnly, gzip.BestCompression)
+	}
+	return level, nil
+}
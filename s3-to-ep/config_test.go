@@ -0,0 +1,316 @@
+package main
+
+import (
+	"compress/gzip"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildTestConfig loads the configuration from the environment. EP host defaults to localhost if not set.
+func buildTestConfig(t *testing.T) *Config {
+	if os.Getenv(epHostEnvKey) == "" {
+		assert.NoError(t, os.Setenv(epHostEnvKey, "http://localhost"))
+		t.Cleanup(func() {
+			_ = os.Unsetenv(epHostEnvKey)
+		})
+	}
+
+	cfg, err := loadConfig(os.Getenv)
+	assert.NoError(t, err)
+	return cfg
+}
+
+func Test_loadConfig_noOptionalEnvSet_useDefault(t *testing.T) {
+	cfg := buildTestConfig(t)
+	assert.Equal(t, "http://localhost", cfg.EPHost.String())
+	assert.Nil(t, cfg.TLSCertificate)
+	assert.Nil(t, cfg.TLSRootCAs)
+	assert.Empty(t, cfg.TLSServerName)
+	assert.Equal(t, uint16(defaultTLSMinVersion), cfg.TLSMinVersion)
+	assert.Nil(t, cfg.TLSCipherSuites)
+	assert.False(t, cfg.TLSInsecureSkipVerify)
+	assert.Empty(t, cfg.EncodingMethod)
+	assert.Equal(t, gzip.DefaultCompression, cfg.CompressionLevel)
+	assert.False(t, cfg.HECTokenInQuery)
+	assert.Equal(t, defaultSourcetype, cfg.Sourcetype)
+	assert.Equal(t, defaultIndex, cfg.Index)
+	assert.Equal(t, defaultSource, cfg.Source)
+	assert.Equal(t, defaultHost, cfg.Host)
+	assert.Nil(t, cfg.KeyPattern)
+	assert.Equal(t, autoDecoderName, cfg.Decoder)
+	assert.Equal(t, rawRecordOutput, cfg.VPCFlowLogOutput)
+	assert.Equal(t, rawRecordOutput, cfg.ELBLogOutput)
+	assert.Equal(t, rawRecordOutput, cfg.CloudFrontLogOutput)
+	assert.Empty(t, cfg.ParquetTimestampColumn)
+	assert.Nil(t, cfg.JSONArrayPath)
+	assert.Nil(t, cfg.JSONFieldKeys)
+	assert.Nil(t, cfg.TimestampField)
+	assert.Nil(t, cfg.TimestampRegex)
+	assert.Equal(t, time.UTC, cfg.TimestampLocation)
+	assert.Equal(t, defaultTimestampMaxLookahead, cfg.TimestampMaxLookahead)
+	assert.False(t, cfg.IsRawEvent)
+	assert.Nil(t, cfg.Fields)
+	assert.Equal(t, defaultLineBreaker, cfg.LineBreaker.String())
+	assert.Equal(t, defaultBreakOnlyBefore, cfg.BreakOnlyBefore.String())
+	assert.False(t, cfg.ShouldLineMerge)
+	assert.Equal(t, defaultMaxEventSize, cfg.MaxEventSize)
+	assert.Equal(t, defaultBatchMaxBytes, cfg.BatchMaxBytes)
+	assert.Equal(t, defaultBatchMaxEvents, cfg.BatchMaxEvents)
+	assert.Equal(t, defaultBatchMaxLinger, cfg.BatchMaxLinger)
+	assert.Equal(t, defaultRetryMaxAttempts, cfg.RetryMaxAttempts)
+	assert.Equal(t, defaultRetryBaseDelay, cfg.RetryBaseDelay)
+	assert.Equal(t, defaultRetryMaxDelay, cfg.RetryMaxDelay)
+	assert.Equal(t, defaultMaxConcurrency, cfg.MaxConcurrency)
+}
+
+func Test_loadConfig_invalidEnv_error(t *testing.T) {
+	tests := []struct {
+		name   string
+		envKey string
+		envVal string
+	}{
+		{
+			name:   "ep host has no scheme",
+			envKey: epHostEnvKey,
+			envVal: "localhost:8088",
+		},
+		{
+			name:   "ep host has unsupported scheme",
+			envKey: epHostEnvKey,
+			envVal: "ftp://localhost",
+		},
+		{
+			name:   "invalid ca cert",
+			envKey: epTLSCACertEnvKey,
+			envVal: "not-a-cert",
+		},
+		{
+			name:   "unsupported tls version",
+			envKey: tlsMinVersionEnvKey,
+			envVal: "TLS1.2",
+		},
+		{
+			name:   "unsupported cipher suite",
+			envKey: tlsCipherSuitesEnvKey,
+			envVal: "TLS_RSA_WITH_RC4_128_SHA",
+		},
+		{
+			name:   "insecure skip verify is not a bool",
+			envKey: tlsInsecureSkipVerifyEnvKey,
+			envVal: "sure",
+		},
+		{
+			name:   "unknown template variable",
+			envKey: sourceEnvKey,
+			envVal: "s3://{bucket}/{account}",
+		},
+		{
+			name:   "invalid key regex",
+			envKey: keyRegexEnvKey,
+			envVal: "(?P<account>",
+		},
+		{
+			name:   "unsupported timestamp format directive",
+			envKey: timestampFormatEnvKey,
+			envVal: "%Y-%m-%d %Q",
+		},
+		{
+			name:   "invalid timestamp timezone",
+			envKey: timestampTimezoneEnvKey,
+			envVal: "Mars/Olympus_Mons",
+		},
+		{
+			name:   "invalid timestamp regex",
+			envKey: timestampRegexEnvKey,
+			envVal: "(time",
+		},
+		{
+			name:   "unsupported decoder",
+			envKey: decoderEnvKey,
+			envVal: "xml",
+		},
+		{
+			name:   "unsupported vpc flow log output",
+			envKey: vpcFlowLogOutputEnvKey,
+			envVal: "xml",
+		},
+		{
+			name:   "unsupported elb log output",
+			envKey: elbLogOutputEnvKey,
+			envVal: "xml",
+		},
+		{
+			name:   "unsupported cloudfront log output",
+			envKey: cloudFrontLogOutputEnvKey,
+			envVal: "xml",
+		},
+		{
+			name:   "invalid json array path",
+			envKey: jsonArrayPathEnvKey,
+			envVal: "data..items",
+		},
+		{
+			name:   "invalid json field keys",
+			envKey: jsonFieldKeysEnvKey,
+			envVal: "env,,region",
+		},
+		{
+			name:   "unsupported encoding method",
+			envKey: encodingMethodEnvKey,
+			envVal: "compress",
+		},
+		{
+			name:   "compression level is not a number",
+			envKey: compressionLevelEnvKey,
+			envVal: "best",
+		},
+		{
+			name:   "compression level is out of range",
+			envKey: compressionLevelEnvKey,
+			envVal: "10",
+		},
+		{
+			name:   "is raw event is not a bool",
+			envKey: eventIsRawEnvKey,
+			envVal: "raw",
+		},
+		{
+			name:   "invalid fields",
+			envKey: fieldsEnvKey,
+			envVal: "a=1,b",
+		},
+		{
+			name:   "invalid line breaker regex",
+			envKey: lineBreakerEnvKey,
+			envVal: "([\\n]+",
+		},
+		{
+			name:   "invalid break only before regex",
+			envKey: breakOnlyBeforeEnvKey,
+			envVal: "[a-",
+		},
+		{
+			name:   "max event size is not a number",
+			envKey: maxEventSizeEnvKey,
+			envVal: "big",
+		},
+		{
+			name:   "max event size is not positive",
+			envKey: maxEventSizeEnvKey,
+			envVal: "0",
+		},
+		{
+			name:   "batch max bytes is not a number",
+			envKey: batchMaxBytesEnvKey,
+			envVal: "1MB",
+		},
+		{
+			name:   "batch max events is negative",
+			envKey: batchMaxEventsEnvKey,
+			envVal: "-1",
+		},
+		{
+			name:   "batch max linger is not a duration",
+			envKey: batchMaxLingerEnvKey,
+			envVal: "5",
+		},
+		{
+			name:   "retry max delay is negative",
+			envKey: retryMaxDelayEnvKey,
+			envVal: "-1s",
+		},
+		{
+			name:   "max concurrency is not positive",
+			envKey: maxConcurrencyEnvKey,
+			envVal: "0",
+		},
+	}
+
+	assert.NoError(t, os.Setenv(epHostEnvKey, "http://localhost"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prevVal := os.Getenv(tt.envKey)
+			assert.NoError(t, os.Setenv(tt.envKey, tt.envVal))
+			t.Cleanup(func() {
+				_ = os.Setenv(tt.envKey, prevVal)
+			})
+
+			cfg, err := loadConfig(os.Getenv)
+			assert.ErrorContains(t, err, tt.envKey)
+			assert.Nil(t, cfg)
+		})
+	}
+}
+
+func Test_loadConfig_invalidTLSKeyPair_error(t *testing.T) {
+	assert.NoError(t, os.Setenv(epHostEnvKey, "https://localhost"))
+	assert.NoError(t, os.Setenv(epTLSClientCertEnvKey, "not-a-cert"))
+	assert.NoError(t, os.Setenv(epTLSClientPrivateKeyEnvKey, "not-a-key"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+		_ = os.Unsetenv(epTLSClientCertEnvKey)
+		_ = os.Unsetenv(epTLSClientPrivateKeyEnvKey)
+	})
+
+	cfg, err := loadConfig(os.Getenv)
+	assert.ErrorContains(t, err, epTLSClientCertEnvKey)
+	assert.Nil(t, cfg)
+}
+
+func Test_loadConfig_partialTLSKeyPair_noCertificate(t *testing.T) {
+	tests := []struct {
+		name   string
+		envKey string
+		envVal string
+	}{
+		{
+			name:   "only client cert is set",
+			envKey: epTLSClientCertEnvKey,
+			envVal: "test-cert",
+		},
+		{
+			name:   "only client key is set",
+			envKey: epTLSClientPrivateKeyEnvKey,
+			envVal: "test-key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, os.Setenv(tt.envKey, tt.envVal))
+			t.Cleanup(func() {
+				_ = os.Unsetenv(tt.envKey)
+			})
+
+			cfg := buildTestConfig(t)
+			assert.Nil(t, cfg.TLSCertificate)
+		})
+	}
+}
+
+func Test_loadConfig_multipleInvalidEnv_allReported(t *testing.T) {
+	assert.NoError(t, os.Setenv(encodingMethodEnvKey, "compress"))
+	assert.NoError(t, os.Setenv(batchMaxEventsEnvKey, "many"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(encodingMethodEnvKey)
+		_ = os.Unsetenv(batchMaxEventsEnvKey)
+	})
+
+	cfg, err := loadConfig(os.Getenv)
+	assert.Nil(t, cfg)
+	assert.Error(t, err)
+	problems := strings.Split(err.Error(), "\n")
+	assert.Equal(t, []string{
+		"EDGE_PROCESSOR_HOST has not been provided",
+		"ENCODING_METHOD compress is not supported. Only GZIP is supported",
+		"BATCH_MAX_EVENTS must be a positive integer",
+	}, problems)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configSourceEnvKey = "CONFIG_SOURCE"
+
+	fileConfigScheme = "file"
+	s3ConfigScheme   = "s3"
+	ssmConfigScheme  = "ssm"
+)
+
+type SSMClient interface {
+	GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
+}
+
+// loadConfigFromSources loads the configuration from the environment. If CONFIG_SOURCE is set,
+// keys not set in the environment are read from the config document it points to.
+func loadConfigFromSources(ctx context.Context, getenv func(string) string, s3Client S3Client, ssmClient SSMClient) (*Config, error) {
+	source := getenv(configSourceEnvKey)
+	if source == "" {
+		return loadConfig(getenv)
+	}
+
+	document, err := loadConfigDocument(ctx, source, s3Client, ssmClient)
+	if err != nil {
+		return nil, err
+	}
+	return loadConfig(buildConfigLookup(getenv, document))
+}
+
+// loadConfigDocument loads the configuration keys stored at source, which is either a file path,
+// an s3://bucket/key url or an ssm:///parameter/path url. Files and S3 objects are YAML or JSON documents
+// mapping configuration keys to their values. SSM parameters under the path are named after configuration keys.
+func loadConfigDocument(ctx context.Context, source string, s3Client S3Client, ssmClient SSMClient) (map[string]string, error) {
+	sourceUrl, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid url: %w", configSourceEnvKey, err)
+	}
+
+	switch sourceUrl.Scheme {
+	case "", fileConfigScheme:
+		content, err := os.ReadFile(sourceUrl.Path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file: %w", err)
+		}
+		return parseConfigDocument(content)
+	case s3ConfigScheme:
+		s3Object, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(sourceUrl.Host),
+			Key:    aws.String(strings.TrimPrefix(sourceUrl.Path, "/")),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching config object: %w", err)
+		}
+		defer s3Object.Body.Close()
+
+		content, err := io.ReadAll(s3Object.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config object: %w", err)
+		}
+		return parseConfigDocument(content)
+	case ssmConfigScheme:
+		return loadSSMParameters(ctx, ssmClient, sourceUrl.Path)
+	default:
+		return nil, fmt.Errorf("%s scheme %s is not supported", configSourceEnvKey, sourceUrl.Scheme)
+	}
+}
+
+// parseConfigDocument reads a YAML or JSON document. Nested values, such as lists, are kept as YAML
+// so they can be parsed the same way as their env value.
+func parseConfigDocument(content []byte) (map[string]string, error) {
+	var nodes map[string]yaml.Node
+	if err := yaml.Unmarshal(content, &nodes); err != nil {
+		return nil, fmt.Errorf("config document is not a valid YAML or JSON map: %w", err)
+	}
+
+	document := make(map[string]string, len(nodes))
+	for key, node := range nodes {
+		if node.Kind == yaml.ScalarNode {
+			document[key] = node.Value
+			continue
+		}
+
+		value, err := yaml.Marshal(&node)
+		if err != nil {
+			return nil, fmt.Errorf("config key %s can't be read: %w", key, err)
+		}
+		document[key] = string(value)
+	}
+	return document, nil
+}
+
+// loadSSMParameters reads all parameters directly under parameterPath. SecureString parameters are decrypted.
+func loadSSMParameters(ctx context.Context, ssmClient SSMClient, parameterPath string) (map[string]string, error) {
+	document := make(map[string]string)
+	paginator := ssm.NewGetParametersByPathPaginator(ssmClient, &ssm.GetParametersByPathInput{
+		Path:           aws.String(parameterPath),
+		WithDecryption: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching ssm parameters: %w", err)
+		}
+		for _, parameter := range output.Parameters {
+			document[path.Base(aws.ToString(parameter.Name))] = aws.ToString(parameter.Value)
+		}
+	}
+	return document, nil
+}
+
+// buildConfigLookup returns a lookup reading keys from the environment first, then from the config document.
+func buildConfigLookup(getenv func(string) string, document map[string]string) func(string) string {
+	return func(key string) string {
+		if val := getenv(key); val != "" {
+			return val
+		}
+		return document[key]
+	}
+}
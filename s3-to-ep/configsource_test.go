@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfigDocument = `
+EDGE_PROCESSOR_HOST: https://ep.example.com:8088
+BATCH_MAX_EVENTS: 500
+TLS_CLIENT_CA_CERT: |
+  -----BEGIN CERTIFICATE-----
+  abc
+  -----END CERTIFICATE-----
+EVENT_FIELDS:
+  - env=prod
+`
+
+// pagedTestSSMClient serves one page of parameters per call.
+type pagedTestSSMClient struct {
+	pages  [][]types.Parameter
+	params []*ssm.GetParametersByPathInput
+}
+
+func (c *pagedTestSSMClient) GetParametersByPath(_ context.Context, params *ssm.GetParametersByPathInput, _ ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	c.params = append(c.params, params)
+	output := &ssm.GetParametersByPathOutput{
+		Parameters: c.pages[len(c.params)-1],
+	}
+	if len(c.params) < len(c.pages) {
+		output.NextToken = aws.String("next")
+	}
+	return output, nil
+}
+
+func writeTestConfigFile(t *testing.T, content string) string {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0600))
+	return configPath
+}
+
+func Test_parseConfigDocument(t *testing.T) {
+	tests := []struct {
+		name             string
+		content          string
+		expectedDocument map[string]string
+		expectedErr      bool
+	}{
+		{
+			name:    "yaml document",
+			content: testConfigDocument,
+			expectedDocument: map[string]string{
+				"EDGE_PROCESSOR_HOST": "https://ep.example.com:8088",
+				"BATCH_MAX_EVENTS":    "500",
+				"TLS_CLIENT_CA_CERT":  "-----BEGIN CERTIFICATE-----\nabc\n-----END CERTIFICATE-----\n",
+				"EVENT_FIELDS":        "- env=prod\n",
+			},
+		},
+		{
+			name:    "json document",
+			content: `{"EDGE_PROCESSOR_HOST": "http://localhost", "EVENT_IS_RAW": true}`,
+			expectedDocument: map[string]string{
+				"EDGE_PROCESSOR_HOST": "http://localhost",
+				"EVENT_IS_RAW":        "true",
+			},
+		},
+		{
+			name:        "document is not a map",
+			content:     "- a\n- b\n",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := parseConfigDocument([]byte(tt.content))
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedDocument, document)
+		})
+	}
+}
+
+func Test_loadConfigDocument_sources(t *testing.T) {
+	configPath := writeTestConfigFile(t, `EDGE_PROCESSOR_HOST: http://file`)
+	s3Client := &objectsTestS3Client{
+		objects: map[string]string{
+			"configs/s3-to-ep.json": `{"EDGE_PROCESSOR_HOST": "http://s3"}`,
+		},
+	}
+	ssmClient := &pagedTestSSMClient{
+		pages: [][]types.Parameter{
+			{{Name: aws.String("/s3-to-ep/prod/EDGE_PROCESSOR_HOST"), Value: aws.String("http://ssm")}},
+			{{Name: aws.String("/s3-to-ep/prod/HEC_TOKEN"), Value: aws.String("test-token")}},
+		},
+	}
+
+	tests := []struct {
+		name             string
+		source           string
+		expectedDocument map[string]string
+	}{
+		{
+			name:             "file path",
+			source:           configPath,
+			expectedDocument: map[string]string{"EDGE_PROCESSOR_HOST": "http://file"},
+		},
+		{
+			name:             "file url",
+			source:           "file://" + configPath,
+			expectedDocument: map[string]string{"EDGE_PROCESSOR_HOST": "http://file"},
+		},
+		{
+			name:             "s3 object",
+			source:           "s3://test-bucket/configs/s3-to-ep.json",
+			expectedDocument: map[string]string{"EDGE_PROCESSOR_HOST": "http://s3"},
+		},
+		{
+			name:   "ssm parameter path",
+			source: "ssm:///s3-to-ep/prod",
+			expectedDocument: map[string]string{
+				"EDGE_PROCESSOR_HOST": "http://ssm",
+				"HEC_TOKEN":           "test-token",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := loadConfigDocument(context.Background(), tt.source, s3Client, ssmClient)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedDocument, document)
+		})
+	}
+
+	assert.Len(t, ssmClient.params, 2)
+	assert.Equal(t, "/s3-to-ep/prod", aws.ToString(ssmClient.params[0].Path))
+	assert.True(t, aws.ToBool(ssmClient.params[0].WithDecryption))
+}
+
+func Test_loadConfigDocument_invalidSource_error(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{
+			name:   "missing file",
+			source: filepath.Join(t.TempDir(), "missing.yaml"),
+		},
+		{
+			name:   "missing s3 object",
+			source: "s3://test-bucket/missing.yaml",
+		},
+		{
+			name:   "unsupported scheme",
+			source: "https://example.com/config.yaml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := loadConfigDocument(context.Background(), tt.source, &objectsTestS3Client{}, &pagedTestSSMClient{})
+			assert.Error(t, err)
+			assert.Nil(t, document)
+		})
+	}
+}
+
+func Test_loadConfigFromSources_envOverridesDocument(t *testing.T) {
+	configPath := writeTestConfigFile(t, "EDGE_PROCESSOR_HOST: http://file\nEVENT_INDEX: file-index\nBATCH_MAX_EVENTS: 500\n")
+	assert.NoError(t, os.Setenv(configSourceEnvKey, configPath))
+	assert.NoError(t, os.Setenv(indexEnvKey, "env-index"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(configSourceEnvKey)
+		_ = os.Unsetenv(indexEnvKey)
+	})
+
+	cfg, err := loadConfigFromSources(context.Background(), os.Getenv, &objectsTestS3Client{}, &pagedTestSSMClient{})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://file", cfg.EPHost.String())
+	assert.Equal(t, "env-index", cfg.Index)
+	assert.Equal(t, 500, cfg.BatchMaxEvents)
+	assert.Equal(t, defaultSourcetype, cfg.Sourcetype)
+}
+
+func Test_loadConfigFromSources_invalidDocumentValue_error(t *testing.T) {
+	configPath := writeTestConfigFile(t, "EDGE_PROCESSOR_HOST: http://file\nBATCH_MAX_EVENTS: many\n")
+	assert.NoError(t, os.Setenv(configSourceEnvKey, configPath))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(configSourceEnvKey)
+	})
+
+	cfg, err := loadConfigFromSources(context.Background(), os.Getenv, &objectsTestS3Client{}, &pagedTestSSMClient{})
+	assert.ErrorContains(t, err, batchMaxEventsEnvKey)
+	assert.Nil(t, cfg)
+}
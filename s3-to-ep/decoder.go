@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	decoderEnvKey = "DECODER"
+
+	// autoDecoderName detects the decoder from the object key, or uses the line decoder
+	autoDecoderName        = "auto"
+	lineDecoderName        = "line"
+	cloudTrailDecoderName  = "cloudtrail"
+	vpcFlowLogDecoderName  = "vpcflow"
+	elbDecoderName         = "elb"
+	cloudFrontDecoderName  = "cloudfront"
+	s3AccessLogDecoderName = "s3access"
+	parquetDecoderName     = "parquet"
+	jsonDecoderName        = "json"
+
+	defaultDecoderName = autoDecoderName
+
+	// rawRecordOutput sends records of AWS logs with named fields as written
+	rawRecordOutput = "raw"
+	// jsonRecordOutput sends records as JSON objects with named fields
+	jsonRecordOutput = "json"
+	// fieldsRecordOutput sends records as written with named fields as HEC indexed fields
+	fieldsRecordOutput = "fields"
+
+	defaultRecordOutput = rawRecordOutput
+
+	// recordNoData is the value of fields which don't apply to the record
+	recordNoData = "-"
+)
+
+// decodedEvent is an event read from the object content. time is zero if the decoder doesn't know
+// the time of the event. fields are indexed fields added to the event. host, source and sourcetype
+// replace the metadata of the object if set.
+type decodedEvent struct {
+	content    string
+	time       time.Time
+	fields     map[string]string
+	host       string
+	source     string
+	sourcetype string
+}
+
+// eventDecoder splits the content of an object into events.
+type eventDecoder interface {
+	decode(reader io.Reader, emit func(event decodedEvent) error) error
+}
+
+// decoderSourcetypes are the sourcetypes of events read by decoders of well known AWS logs.
+var decoderSourcetypes = map[string]string{
+	cloudTrailDecoderName:  cloudTrailSourcetype,
+	vpcFlowLogDecoderName:  vpcFlowLogSourcetype,
+	elbDecoderName:         elbSourcetype,
+	cloudFrontDecoderName:  cloudFrontSourcetype,
+	s3AccessLogDecoderName: s3AccessLogSourcetype,
+}
+
+// decoderKeyLayouts detect the decoder of AWS logs from the key layout they are delivered with.
+var decoderKeyLayouts = []struct {
+	decoderName string
+	keyRegex    *regexp.Regexp
+}{
+	{decoderName: cloudTrailDecoderName, keyRegex: cloudTrailKeyRegex},
+	{decoderName: vpcFlowLogDecoderName, keyRegex: vpcFlowLogKeyRegex},
+	{decoderName: elbDecoderName, keyRegex: elbKeyRegex},
+	{decoderName: cloudFrontDecoderName, keyRegex: cloudFrontKeyRegex},
+	{decoderName: s3AccessLogDecoderName, keyRegex: s3AccessLogKeyRegex},
+	{decoderName: parquetDecoderName, keyRegex: parquetKeyRegex},
+}
+
+func parseDecoderName(key, decoderName string) (string, error) {
+	switch decoderName {
+	case "":
+		return defaultDecoderName, nil
+	case autoDecoderName, lineDecoderName, cloudTrailDecoderName, vpcFlowLogDecoderName, elbDecoderName,
+		cloudFrontDecoderName, s3AccessLogDecoderName, parquetDecoderName, jsonDecoderName:
+		return decoderName, nil
+	default:
+		return "", fmt.Errorf("%s %s is not supported", key, decoderName)
+	}
+}
+
+// detectDecoderName returns the decoder of objectKey if it follows the key layout of AWS logs.
+func detectDecoderName(objectKey string) string {
+	for _, layout := range decoderKeyLayouts {
+		if layout.keyRegex.MatchString(objectKey) {
+			return layout.decoderName
+		}
+	}
+	return lineDecoderName
+}
+
+// buildEventDecoder returns the decoder of cfg. The line decoder is breaker.
+func buildEventDecoder(cfg *Config, breaker *lineBreaker) eventDecoder {
+	switch cfg.Decoder {
+	case cloudTrailDecoderName:
+		return &cloudTrailDecoder{maxEventSize: cfg.MaxEventSize}
+	case vpcFlowLogDecoderName:
+		return &vpcFlowLogDecoder{output: cfg.VPCFlowLogOutput, maxEventSize: cfg.MaxEventSize}
+	case elbDecoderName:
+		return &elbLogDecoder{output: cfg.ELBLogOutput, maxEventSize: cfg.MaxEventSize}
+	case cloudFrontDecoderName:
+		return &cloudFrontLogDecoder{output: cfg.CloudFrontLogOutput, maxEventSize: cfg.MaxEventSize}
+	case s3AccessLogDecoderName:
+		return &s3AccessLogDecoder{maxEventSize: cfg.MaxEventSize}
+	case parquetDecoderName:
+		return &parquetDecoder{
+			timestampColumn: cfg.ParquetTimestampColumn,
+			timestamps:      &timestampExtractor{layout: cfg.TimestampLayout, location: cfg.TimestampLocation},
+		}
+	case jsonDecoderName:
+		return &jsonDecoder{
+			arrayPath:     cfg.JSONArrayPath,
+			hostKey:       cfg.JSONHostKey,
+			sourceKey:     cfg.JSONSourceKey,
+			sourcetypeKey: cfg.JSONSourcetypeKey,
+			timeKey:       cfg.JSONTimeKey,
+			fieldKeys:     cfg.JSONFieldKeys,
+			timestamps:    &timestampExtractor{layout: cfg.TimestampLayout, location: cfg.TimestampLocation},
+			maxEventSize:  cfg.MaxEventSize,
+		}
+	default:
+		return breaker
+	}
+}
+
+func parseRecordOutput(key, output string) (string, error) {
+	switch output {
+	case "":
+		return defaultRecordOutput, nil
+	case rawRecordOutput, jsonRecordOutput, fieldsRecordOutput:
+		return output, nil
+	default:
+		return "", fmt.Errorf("%s %s is not supported. Supported outputs are %s, %s and %s", key, output,
+			rawRecordOutput, jsonRecordOutput, fieldsRecordOutput)
+	}
+}
+
+// buildRecordEvent builds the event of a record written as content, with the values of fieldNames.
+// Fields without data are left out of JSON and indexed fields, as are values without a name.
+func buildRecordEvent(output, content string, fieldNames, values []string) decodedEvent {
+	event := decodedEvent{content: content}
+	jsonFields := make([]string, 0, len(fieldNames))
+	for i, name := range fieldNames {
+		if i >= len(values) || values[i] == recordNoData {
+			continue
+		}
+
+		switch output {
+		case jsonRecordOutput:
+			nameBytes, _ := json.Marshal(name)
+			valueBytes, _ := json.Marshal(values[i])
+			jsonFields = append(jsonFields, string(nameBytes)+":"+string(valueBytes))
+		case fieldsRecordOutput:
+			if event.fields == nil {
+				event.fields = make(map[string]string, len(fieldNames))
+			}
+			event.fields[name] = values[i]
+		}
+	}
+
+	if output == jsonRecordOutput {
+		event.content = "{" + strings.Join(jsonFields, ",") + "}"
+	}
+	return event
+}
+
+// decodeLines calls decodeLine with each non empty line of reader, without its line break.
+// Lines bigger than maxEventSize are truncated, and only maxEventSize bytes of a line are held in memory.
+func decodeLines(reader io.Reader, maxEventSize int, decodeLine func(line string) error) error {
+	bufferedReader := bufio.NewReader(reader)
+	var line []byte
+	for {
+		chunk, err := bufferedReader.ReadSlice('\n')
+		isLineEnd := !errors.Is(err, bufio.ErrBufferFull)
+		if err != nil && isLineEnd && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		// keep one byte more than maxEventSize so that the line is truncated once its line break is trimmed,
+		// and discard the rest of the line
+		if room := maxEventSize + 1 - len(line); room > 0 {
+			line = append(line, chunk[:min(room, len(chunk))]...)
+		}
+		if !isLineEnd {
+			continue
+		}
+
+		if trimmed := strings.TrimRight(string(line), "\r\n"); trimmed != "" {
+			if decodeErr := decodeLine(truncateEvent(trimmed, maxEventSize)); decodeErr != nil {
+				return decodeErr
+			}
+		}
+		line = line[:0]
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
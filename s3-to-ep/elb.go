@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	elbLogOutputEnvKey = "ELB_LOG_OUTPUT"
+
+	elbSourcetype = "aws:elb:accesslogs"
+
+	// nlbTimeLayout is the time layout of NLB access logs, which are in UTC without a timezone
+	nlbTimeLayout = "2006-01-02T15:04:05"
+)
+
+// elbKeyRegex matches the keys of ALB, NLB and Classic ELB access log files:
+// [prefix/]AWSLogs/account/elasticloadbalancing/region/yyyy/mm/dd/file.log.gz
+var elbKeyRegex = regexp.MustCompile(`(^|/)AWSLogs/\d{12}/elasticloadbalancing/`)
+
+// elbLogFormat is the field list of the access logs of a load balancer type.
+// timeField is the index of the field holding the time of the request.
+type elbLogFormat struct {
+	fieldNames []string
+	timeField  int
+}
+
+var (
+	albLogFormat = elbLogFormat{
+		fieldNames: []string{
+			"type", "time", "elb", "client", "target", "request_processing_time", "target_processing_time",
+			"response_processing_time", "elb_status_code", "target_status_code", "received_bytes", "sent_bytes",
+			"request", "user_agent", "ssl_cipher", "ssl_protocol", "target_group_arn", "trace_id", "domain_name",
+			"chosen_cert_arn", "matched_rule_priority", "request_creation_time", "actions_executed", "redirect_url",
+			"error_reason", "target_list", "target_status_code_list", "classification", "classification_reason",
+			"conn_trace_id",
+		},
+		timeField: 1,
+	}
+	nlbLogFormat = elbLogFormat{
+		fieldNames: []string{
+			"type", "version", "time", "elb", "listener", "client", "destination", "connection_time",
+			"tls_handshake_time", "received_bytes", "sent_bytes", "incoming_tls_alert", "chosen_cert_arn",
+			"chosen_cert_serial", "tls_cipher", "tls_protocol_version", "tls_named_group", "domain_name",
+			"alpn_fe_protocol", "alpn_be_protocol", "alpn_client_preference_list", "tls_connection_creation_time",
+		},
+		timeField: 2,
+	}
+	classicELBLogFormat = elbLogFormat{
+		fieldNames: []string{
+			"time", "elb", "client", "backend", "request_processing_time", "backend_processing_time",
+			"response_processing_time", "elb_status_code", "backend_status_code", "received_bytes", "sent_bytes",
+			"request", "user_agent", "ssl_cipher", "ssl_protocol",
+		},
+		timeField: 0,
+	}
+)
+
+// detectELBLogFormat detects the load balancer type from the values of a log line: ALB names start
+// with app/, NLB names with net/ and Classic ELB lines start with the time. It returns false for
+// other lines, such as ALB connection logs.
+func detectELBLogFormat(values []string) (elbLogFormat, bool) {
+	switch {
+	case len(values) > 3 && strings.HasPrefix(values[3], "net/"):
+		return nlbLogFormat, true
+	case len(values) > 2 && strings.HasPrefix(values[2], "app/"):
+		return albLogFormat, true
+	case len(values) > 1:
+		if _, ok := parseELBTime(values[0]); ok {
+			return classicELBLogFormat, true
+		}
+	}
+	return elbLogFormat{}, false
+}
+
+func parseELBTime(value string) (time.Time, bool) {
+	if eventTime, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return eventTime, true
+	}
+	eventTime, err := time.Parse(nlbTimeLayout, value)
+	return eventTime, err == nil
+}
+
+// splitELBLogLine splits a log line into values separated by spaces. Quoted values may hold spaces
+// and escaped quotes, and are unquoted.
+func splitELBLogLine(line string) []string {
+	var values []string
+	for i := 0; i < len(line); {
+		if line[i] == ' ' {
+			i++
+			continue
+		}
+		if line[i] != '"' {
+			end := strings.IndexByte(line[i:], ' ')
+			if end < 0 {
+				end = len(line) - i
+			}
+			values = append(values, line[i:i+end])
+			i += end
+			continue
+		}
+
+		// a quoted value ends with a quote followed by a space or the end of the line
+		var value strings.Builder
+		i++
+		for ; i < len(line); i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				i++
+				value.WriteByte(line[i])
+				continue
+			}
+			if line[i] == '"' && (i+1 == len(line) || line[i+1] == ' ') {
+				i++
+				break
+			}
+			value.WriteByte(line[i])
+		}
+		values = append(values, value.String())
+	}
+	return values
+}
+
+// elbLogDecoder emits each request of an ALB, NLB or Classic ELB access log file as an event with
+// the time of the request. Lines which aren't requests of a known load balancer type are sent as is.
+type elbLogDecoder struct {
+	output       string
+	maxEventSize int
+}
+
+func (d *elbLogDecoder) decode(reader io.Reader, emit func(event decodedEvent) error) error {
+	return decodeLines(reader, d.maxEventSize, func(line string) error {
+		return emit(d.buildEvent(line))
+	})
+}
+
+func (d *elbLogDecoder) buildEvent(line string) decodedEvent {
+	values := splitELBLogLine(line)
+	format, found := detectELBLogFormat(values)
+	if !found {
+		return decodedEvent{content: line}
+	}
+
+	event := buildRecordEvent(d.output, line, format.fieldNames, values)
+	if eventTime, ok := parseELBTime(values[format.timeField]); ok {
+		event.time = eventTime
+	}
+	return event
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testALBLogLine = `http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 ` +
+		`0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.46.0" - - ` +
+		`arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 ` +
+		`"Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2018-07-02T22:22:48.364000Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`
+	testNLBLogLine = `tls 2.0 2018-12-20T02:59:40 net/my-network-loadbalancer/c6e77e28c25b2234 g3d4b5e8bb8464cd ` +
+		`72.21.218.154:51341 172.100.100.185:443 5 2 98 246 - ` +
+		`arn:aws:acm:us-east-2:671290407336:certificate/2a108f19-aded-46b0-8493-c63eb1ef4a99 - ECDHE-RSA-AES128-SHA ` +
+		`tlsv12 - my-network-loadbalancer-c6e77e28c25b2234.elb.us-east-2.amazonaws.com h2 h2 "h2","http/1.1" 2018-12-20T02:59:38`
+	testClassicELBLogLine = `2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 ` +
+		`200 200 0 29 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0 \"beta\"" - -`
+)
+
+func Test_splitELBLogLine(t *testing.T) {
+	tests := []struct {
+		name           string
+		line           string
+		expectedValues []string
+	}{
+		{
+			name:           "quoted values",
+			line:           `200 "GET / HTTP/1.1" "-" 34`,
+			expectedValues: []string{"200", "GET / HTTP/1.1", "-", "34"},
+		},
+		{
+			name:           "escaped quotes",
+			line:           `"agent \"beta\"" -`,
+			expectedValues: []string{`agent "beta"`, "-"},
+		},
+		{
+			name:           "quotes inside a quoted value",
+			line:           `h2 "h2","http/1.1" 2018-12-20T02:59:38`,
+			expectedValues: []string{"h2", `h2","http/1.1`, "2018-12-20T02:59:38"},
+		},
+		{
+			name:           "unterminated quoted value",
+			line:           `200 "GET /`,
+			expectedValues: []string{"200", "GET /"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedValues, splitELBLogLine(tt.line))
+		})
+	}
+}
+
+func Test_elbLogDecoder_decode(t *testing.T) {
+	tests := []struct {
+		name           string
+		line           string
+		expectedTime   time.Time
+		expectedFields map[string]string
+	}{
+		{
+			name:         "alb",
+			line:         testALBLogLine,
+			expectedTime: time.Date(2018, 7, 2, 22, 23, 0, 186641000, time.UTC),
+			expectedFields: map[string]string{
+				"type":        "http",
+				"elb":         "app/my-loadbalancer/50dc6c495c0c9188",
+				"request":     "GET http://www.example.com:80/ HTTP/1.1",
+				"user_agent":  "curl/7.46.0",
+				"trace_id":    "Root=1-58337262-36d228ad5d99923122bbe354",
+				"target_list": "10.0.0.1:80",
+			},
+		},
+		{
+			name:         "nlb",
+			line:         testNLBLogLine,
+			expectedTime: time.Date(2018, 12, 20, 2, 59, 40, 0, time.UTC),
+			expectedFields: map[string]string{
+				"type":                         "tls",
+				"elb":                          "net/my-network-loadbalancer/c6e77e28c25b2234",
+				"listener":                     "g3d4b5e8bb8464cd",
+				"tls_connection_creation_time": "2018-12-20T02:59:38",
+			},
+		},
+		{
+			name:         "classic",
+			line:         testClassicELBLogLine,
+			expectedTime: time.Date(2015, 5, 13, 23, 39, 43, 945958000, time.UTC),
+			expectedFields: map[string]string{
+				"elb":        "my-loadbalancer",
+				"backend":    "10.0.0.1:80",
+				"user_agent": `curl/7.38.0 "beta"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decodedEvents []decodedEvent
+			err := (&elbLogDecoder{output: jsonRecordOutput, maxEventSize: defaultMaxEventSize}).decode(strings.NewReader(tt.line+"\n"), func(event decodedEvent) error {
+				decodedEvents = append(decodedEvents, event)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Len(t, decodedEvents, 1)
+			assert.Equal(t, tt.expectedTime, decodedEvents[0].time)
+
+			var fields map[string]string
+			assert.NoError(t, json.Unmarshal([]byte(decodedEvents[0].content), &fields))
+			for key, value := range tt.expectedFields {
+				assert.Equal(t, value, fields[key], key)
+			}
+			// fields without data are left out
+			assert.NotContains(t, fields, "ssl_cipher")
+			assert.NotContains(t, fields, "chosen_cert_serial")
+		})
+	}
+}
+
+func Test_elbLogDecoder_decode_raw(t *testing.T) {
+	content := testClassicELBLogLine + "\n" + "unknown log line\n"
+
+	var decodedEvents []decodedEvent
+	err := (&elbLogDecoder{output: rawRecordOutput, maxEventSize: defaultMaxEventSize}).decode(strings.NewReader(content), func(event decodedEvent) error {
+		decodedEvents = append(decodedEvents, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []decodedEvent{
+		{content: testClassicELBLogLine, time: time.Date(2015, 5, 13, 23, 39, 43, 945958000, time.UTC)},
+		// lines of unknown load balancer types are sent as is
+		{content: "unknown log line"},
+	}, decodedEvents)
+}
+
+func Test_elbLogDecoder_decode_lineBiggerThanMaxEventSize_truncated(t *testing.T) {
+	content := "unknown " + strings.Repeat("x", 10000) + "\nunknown log line\n"
+
+	var decodedEvents []decodedEvent
+	err := (&elbLogDecoder{output: rawRecordOutput, maxEventSize: 20}).decode(strings.NewReader(content), func(event decodedEvent) error {
+		decodedEvents = append(decodedEvents, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []decodedEvent{
+		{content: "unknown xxxxxxxxxxxx"},
+		{content: "unknown log line"},
+	}, decodedEvents)
+}
+
+func Test_recordsProcessor_process_elbLogs(t *testing.T) {
+	const logKey = "AWSLogs/123456789012/elasticloadbalancing/us-east-2/2018/07/02/" +
+		"123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.50dc6c495c0c9188_20180702T2225Z_192.168.131.39_abc.log.gz"
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var hecEvents []hecEvent
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost"+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		decoder := json.NewDecoder(req.Body)
+		for decoder.More() {
+			var event hecEvent
+			assert.NoError(t, decoder.Decode(&event))
+			hecEvents = append(hecEvents, event)
+		}
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	s3Client := &objectsTestS3Client{objects: map[string]string{logKey: testALBLogLine + "\n" + testALBLogLine}}
+	h := newHandler(buildTestConfig(t), s3Client, &http.Client{}, &mapTestSecretsManagerClient{})
+
+	errs := h.processor.process(context.Background(), []events.S3EventRecord{buildTestRecord(logKey)})
+	assert.Equal(t, []error{nil}, errs)
+
+	assert.Len(t, hecEvents, 2)
+	for _, event := range hecEvents {
+		assert.Equal(t, elbSourcetype, event.Sourcetype)
+		assert.Equal(t, 1530570180.186, event.Time)
+		assert.Equal(t, testALBLogLine, event.Event)
+	}
+}
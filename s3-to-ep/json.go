@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	jsonArrayPathEnvKey     = "JSON_ARRAY_PATH"
+	jsonHostKeyEnvKey       = "JSON_HOST_KEY"
+	jsonSourceKeyEnvKey     = "JSON_SOURCE_KEY"
+	jsonSourcetypeKeyEnvKey = "JSON_SOURCETYPE_KEY"
+	jsonTimeKeyEnvKey       = "JSON_TIME_KEY"
+	jsonFieldKeysEnvKey     = "JSON_FIELD_KEYS"
+)
+
+// parseJSONPath splits a dot separated path of JSON keys such as data.items.
+func parseJSONPath(key, path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	keys := strings.Split(path, ".")
+	for _, jsonKey := range keys {
+		if jsonKey == "" {
+			return nil, fmt.Errorf("%s %q is not a valid path of JSON keys", key, path)
+		}
+	}
+	return keys, nil
+}
+
+// parseJSONFieldKeys parses a comma separated list of JSON key paths. Each path is the name of its field.
+func parseJSONFieldKeys(fieldKeys string) (map[string][]string, error) {
+	if fieldKeys == "" {
+		return nil, nil
+	}
+
+	paths := make(map[string][]string)
+	for _, fieldKey := range strings.Split(fieldKeys, ",") {
+		fieldKey = strings.TrimSpace(fieldKey)
+		path, err := parseJSONPath(jsonFieldKeysEnvKey, fieldKey)
+		if err != nil {
+			return nil, err
+		}
+		if path == nil {
+			return nil, fmt.Errorf("%s has an empty key", jsonFieldKeysEnvKey)
+		}
+		paths[fieldKey] = path
+	}
+	return paths, nil
+}
+
+// lookupJSONField returns the value at path in a decoded JSON document.
+func lookupJSONField(document interface{}, path []string) (interface{}, bool) {
+	value := document
+	for _, key := range path {
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return nil, false
+		}
+		if value = object[key]; value == nil {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// jsonFieldString returns the value of a JSON field as a string. Numbers are kept as written, objects
+// and arrays are their JSON text.
+func jsonFieldString(value interface{}) string {
+	switch fieldValue := value.(type) {
+	case string:
+		return fieldValue
+	case json.Number:
+		return fieldValue.String()
+	case bool:
+		return strconv.FormatBool(fieldValue)
+	default:
+		valueBytes, _ := json.Marshal(fieldValue)
+		return string(valueBytes)
+	}
+}
+
+// jsonDecoder emits each JSON document of newline delimited or concatenated JSON as an event. Elements
+// of top level arrays are emitted as events, or the elements of the array at arrayPath in each document
+// if set. Documents are streamed so only one event is held in memory at a time. Documents bigger than
+// maxEventSize fail the object.
+// The values of the host, source, sourcetype and time keys and of fieldKeys are lifted into the event
+// metadata, the time being parsed with timestamps.
+type jsonDecoder struct {
+	arrayPath     []string
+	hostKey       []string
+	sourceKey     []string
+	sourcetypeKey []string
+	timeKey       []string
+	fieldKeys     map[string][]string
+	timestamps    *timestampExtractor
+	maxEventSize  int
+}
+
+func (d *jsonDecoder) decode(reader io.Reader, emit func(event decodedEvent) error) error {
+	decoder := newSizeLimitedJSONDecoder(reader, d.maxEventSize)
+	for decoder.More() {
+		var err error
+		switch {
+		case d.arrayPath != nil:
+			err = d.decodeArrayPath(decoder, d.arrayPath, emit)
+		case nextJSONByte(decoder.Decoder) == '[':
+			err = d.decodeArray(decoder, emit)
+		default:
+			err = d.decodeDocument(decoder, emit)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("invalid JSON: unexpected content after the last document")
+	}
+	return nil
+}
+
+// nextJSONByte returns the first byte of the next value, which decoder.More buffers after any whitespace.
+func nextJSONByte(decoder *json.Decoder) byte {
+	buffered := decoder.Buffered()
+	var next [1]byte
+	for {
+		if n, _ := buffered.Read(next[:]); n == 0 {
+			return 0
+		}
+		switch next[0] {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return next[0]
+		}
+	}
+}
+
+func (d *jsonDecoder) decodeArray(decoder *sizeLimitedJSONDecoder, emit func(event decodedEvent) error) error {
+	if err := expectJSONDelim(decoder.Decoder, '['); err != nil {
+		return fmt.Errorf("invalid JSON array: %w", err)
+	}
+	for decoder.More() {
+		if err := d.decodeDocument(decoder, emit); err != nil {
+			return err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("invalid JSON array: %w", err)
+	}
+	return nil
+}
+
+// decodeArrayPath emits the elements of the array at path in the next object. Other keys are skipped.
+func (d *jsonDecoder) decodeArrayPath(decoder *sizeLimitedJSONDecoder, path []string, emit func(event decodedEvent) error) error {
+	if err := expectJSONDelim(decoder.Decoder, '{'); err != nil {
+		return fmt.Errorf("invalid JSON document, expected an object holding %s: %w", strings.Join(d.arrayPath, "."), err)
+	}
+
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("invalid JSON document: %w", err)
+		}
+
+		switch {
+		case key != path[0]:
+			_, err = decoder.decodeValue()
+		case len(path) > 1:
+			err = d.decodeArrayPath(decoder, path[1:], emit)
+		default:
+			err = d.decodeArray(decoder, emit)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := decoder.Token()
+	return err
+}
+
+func (d *jsonDecoder) decodeDocument(decoder *sizeLimitedJSONDecoder, emit func(event decodedEvent) error) error {
+	document, err := decoder.decodeValue()
+	if err != nil {
+		return fmt.Errorf("invalid JSON document: %w", err)
+	}
+	return emit(d.buildEvent(document))
+}
+
+func (d *jsonDecoder) buildEvent(document json.RawMessage) decodedEvent {
+	event := decodedEvent{content: string(document)}
+	if d.hostKey == nil && d.sourceKey == nil && d.sourcetypeKey == nil && d.timeKey == nil && d.fieldKeys == nil {
+		return event
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return event
+	}
+
+	event.host, _ = d.lookupString(value, d.hostKey)
+	event.source, _ = d.lookupString(value, d.sourceKey)
+	event.sourcetype, _ = d.lookupString(value, d.sourcetypeKey)
+	if timestamp, found := d.lookupString(value, d.timeKey); found {
+		event.time, _ = d.timestamps.parse(strings.TrimSpace(timestamp))
+	}
+	for name, path := range d.fieldKeys {
+		if fieldValue, found := d.lookupString(value, path); found {
+			if event.fields == nil {
+				event.fields = make(map[string]string, len(d.fieldKeys))
+			}
+			event.fields[name] = fieldValue
+		}
+	}
+	return event
+}
+
+func (d *jsonDecoder) lookupString(document interface{}, path []string) (string, bool) {
+	if path == nil {
+		return "", false
+	}
+	value, found := lookupJSONField(document, path)
+	if !found {
+		return "", false
+	}
+	return jsonFieldString(value), true
+}
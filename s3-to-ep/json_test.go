@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_jsonDecoder_decode(t *testing.T) {
+	tests := []struct {
+		name             string
+		arrayPath        []string
+		content          string
+		expectedContents []string
+		expectedErr      string
+	}{
+		{
+			name:             "newline delimited",
+			content:          "{\"id\": 1}\n{\"id\": 2}\r\n\n{\"id\": 3}\n",
+			expectedContents: []string{`{"id": 1}`, `{"id": 2}`, `{"id": 3}`},
+		},
+		{
+			name:             "concatenated multi-line documents",
+			content:          "{\n  \"id\": 1\n}{\n  \"id\": 2\n}",
+			expectedContents: []string{"{\n  \"id\": 1\n}", "{\n  \"id\": 2\n}"},
+		},
+		{
+			name:             "top level arrays",
+			content:          "[{\"id\": 1}, {\"id\": 2}]\n{\"id\": 3}\n[[4], \"5\"]",
+			expectedContents: []string{`{"id": 1}`, `{"id": 2}`, `{"id": 3}`, `[4]`, `"5"`},
+		},
+		{
+			name:             "array path",
+			arrayPath:        []string{"Records"},
+			content:          `{"Records": [{"id": 1}, {"id": 2}], "count": 2}`,
+			expectedContents: []string{`{"id": 1}`, `{"id": 2}`},
+		},
+		{
+			name:             "nested array path in each document",
+			arrayPath:        []string{"data", "items"},
+			content:          "{\"meta\": {\"items\": [0]}, \"data\": {\"page\": 1, \"items\": [{\"id\": 1}]}}\n{\"data\": {\"items\": [{\"id\": 2}]}}\n{\"data\": {}}",
+			expectedContents: []string{`{"id": 1}`, `{"id": 2}`},
+		},
+		{
+			name:    "empty",
+			content: " \n",
+		},
+		{
+			name:        "truncated document",
+			content:     `{"id": 1}{"id"`,
+			expectedErr: "invalid JSON document",
+		},
+		{
+			name:        "unexpected content",
+			content:     `{"id": 1}]`,
+			expectedErr: "invalid JSON: unexpected content after the last document",
+		},
+		{
+			name:        "array path in an array",
+			arrayPath:   []string{"Records"},
+			content:     `[{"Records": []}]`,
+			expectedErr: "invalid JSON document, expected an object holding Records",
+		},
+		{
+			name:        "array path not an array",
+			arrayPath:   []string{"Records"},
+			content:     `{"Records": {"id": 1}}`,
+			expectedErr: "invalid JSON array",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contents []string
+			decoder := &jsonDecoder{arrayPath: tt.arrayPath, timestamps: &timestampExtractor{location: time.UTC}, maxEventSize: defaultMaxEventSize}
+			err := decoder.decode(strings.NewReader(tt.content), func(event decodedEvent) error {
+				contents = append(contents, event.content)
+				return nil
+			})
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedContents, contents)
+		})
+	}
+}
+
+func Test_jsonDecoder_decode_documentBiggerThanMaxEventSize_error(t *testing.T) {
+	bigDocument := `{"id": "` + strings.Repeat("x", 10000) + `"}`
+	tests := []struct {
+		name      string
+		arrayPath []string
+		content   string
+	}{
+		{
+			name:    "newline delimited",
+			content: `{"id": 1}` + "\n" + bigDocument + "\n" + `{"id": 3}`,
+		},
+		{
+			name:    "slightly bigger document",
+			content: `{"id": 1}` + "\n" + `{"id": "xxxxxxxxxxxxxxxxxxxx"}`,
+		},
+		{
+			name:    "array",
+			content: `[{"id": 1}, ` + bigDocument + `]`,
+		},
+		{
+			name:      "array path",
+			arrayPath: []string{"Records"},
+			content:   `{"Records": [{"id": 1}, ` + bigDocument + `]}`,
+		},
+		{
+			name:      "skipped key",
+			arrayPath: []string{"Records"},
+			content:   `{"Records": [{"id": 1}], "other": ` + bigDocument + `}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contents []string
+			decoder := &jsonDecoder{arrayPath: tt.arrayPath, maxEventSize: 20}
+			err := decoder.decode(strings.NewReader(tt.content), func(event decodedEvent) error {
+				contents = append(contents, event.content)
+				return nil
+			})
+			assert.ErrorContains(t, err, "JSON value is bigger than MAX_EVENT_SIZE of 20 bytes")
+			assert.Equal(t, []string{`{"id": 1}`}, contents)
+		})
+	}
+}
+
+func Test_jsonDecoder_decode_liftedKeys(t *testing.T) {
+	content := `{"host": "web-1", "app": {"name": "api", "env": "prod"}, "type": "app:json", "ts": 1685620800.5, "code": 200, "ok": true}` + "\n" +
+		`{"ts": "not a time", "app": "api"}`
+	fieldKeys, err := parseJSONFieldKeys("app.env, code,ok,missing")
+	assert.NoError(t, err)
+
+	var decodedEvents []decodedEvent
+	decoder := &jsonDecoder{
+		hostKey:       []string{"host"},
+		sourceKey:     []string{"app", "name"},
+		sourcetypeKey: []string{"type"},
+		timeKey:       []string{"ts"},
+		fieldKeys:     fieldKeys,
+		timestamps:    &timestampExtractor{location: time.UTC},
+		maxEventSize:  defaultMaxEventSize,
+	}
+	err = decoder.decode(strings.NewReader(content), func(event decodedEvent) error {
+		decodedEvents = append(decodedEvents, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []decodedEvent{
+		{
+			content:    `{"host": "web-1", "app": {"name": "api", "env": "prod"}, "type": "app:json", "ts": 1685620800.5, "code": 200, "ok": true}`,
+			time:       time.Unix(1685620800, 500000000),
+			fields:     map[string]string{"app.env": "prod", "code": "200", "ok": "true"},
+			host:       "web-1",
+			source:     "api",
+			sourcetype: "app:json",
+		},
+		{
+			// keys which are missing or can't be parsed are ignored
+			content: `{"ts": "not a time", "app": "api"}`,
+		},
+	}, decodedEvents)
+}
+
+func Test_parseJSONFieldKeys(t *testing.T) {
+	fieldKeys, err := parseJSONFieldKeys("env, app.region")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"env": {"env"}, "app.region": {"app", "region"}}, fieldKeys)
+
+	_, err = parseJSONFieldKeys("env,,region")
+	assert.EqualError(t, err, "JSON_FIELD_KEYS has an empty key")
+
+	_, err = parseJSONFieldKeys("app..region")
+	assert.EqualError(t, err, `JSON_FIELD_KEYS "app..region" is not a valid path of JSON keys`)
+}
+
+func Test_recordsProcessor_process_json(t *testing.T) {
+	const key = "apps/api/events.json"
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var hecEvents []hecEvent
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost"+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		decoder := json.NewDecoder(req.Body)
+		for decoder.More() {
+			var event hecEvent
+			assert.NoError(t, decoder.Decode(&event))
+			hecEvents = append(hecEvents, event)
+		}
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	cfg := buildTestConfig(t)
+	cfg.Decoder = jsonDecoderName
+	cfg.JSONArrayPath = []string{"data", "items"}
+	cfg.JSONHostKey = []string{"host"}
+	cfg.JSONTimeKey = []string{"time"}
+	s3Client := &objectsTestS3Client{
+		objects: map[string]string{
+			key: `{"data": {"items": [{"host": "web-1", "time": "2023-06-01T12:00:00Z"}, {"msg": "no metadata"}]}}`,
+		},
+	}
+	h := newHandler(cfg, s3Client, &http.Client{}, &mapTestSecretsManagerClient{})
+
+	errs := h.processor.process(context.Background(), []events.S3EventRecord{buildTestRecord(key)})
+	assert.Equal(t, []error{nil}, errs)
+
+	assert.Len(t, hecEvents, 2)
+	assert.Equal(t, `{"host": "web-1", "time": "2023-06-01T12:00:00Z"}`, hecEvents[0].Event)
+	assert.Equal(t, "web-1", hecEvents[0].Host)
+	assert.Equal(t, float64(1685620800), hecEvents[0].Time)
+	// events without the keys keep the metadata of the object
+	assert.Equal(t, `{"msg": "no metadata"}`, hecEvents[1].Event)
+	assert.Equal(t, "test-bucket", hecEvents[1].Host)
+	assert.Equal(t, "s3://test-bucket/"+key, hecEvents[1].Source)
+}
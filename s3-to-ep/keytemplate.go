@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	hostEnvKey       = "EVENT_HOST"
+	sourceEnvKey     = "EVENT_SOURCE"
+	keyPatternEnvKey = "KEY_PATTERN"
+	keyRegexEnvKey   = "KEY_REGEX"
+
+	defaultHost   = "{bucket}"
+	defaultSource = "s3://{bucket}/{key}"
+
+	bucketVariable   = "bucket"
+	keyVariable      = "key"
+	filenameVariable = "filename"
+
+	// keyPatternRest matches the rest of the key when used as the last segment of a key pattern
+	keyPatternRest = "..."
+)
+
+var keyTemplateVariableRegex = regexp.MustCompile(`\{(\w+)\}`)
+
+// parseKeyPattern returns the regex extracting variables from object keys. Variables are either
+// {name} segments of KEY_PATTERN or named capture groups of KEY_REGEX. It returns nil if none is set.
+func parseKeyPattern(keyPattern, keyRegex string) (*regexp.Regexp, error) {
+	switch {
+	case keyPattern != "" && keyRegex != "":
+		return nil, fmt.Errorf("only one of %s and %s can be set", keyPatternEnvKey, keyRegexEnvKey)
+	case keyRegex != "":
+		parsedRegex, err := regexp.Compile(keyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid regex: %w", keyRegexEnvKey, err)
+		}
+		return parsedRegex, nil
+	case keyPattern != "":
+		parsedRegex, err := regexp.Compile(keyPatternToRegex(keyPattern))
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid key pattern: %w", keyPatternEnvKey, err)
+		}
+		return parsedRegex, nil
+	default:
+		return nil, nil
+	}
+}
+
+// keyPatternToRegex converts a key pattern such as AWSLogs/{account}/{service}/{region}/... to a regex.
+// {name} captures a segment, * matches any segment and a last ... segment matches the rest of the key.
+func keyPatternToRegex(keyPattern string) string {
+	segments := strings.Split(keyPattern, "/")
+	regexSegments := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		if i == len(segments)-1 && segment == keyPatternRest {
+			regexSegments = append(regexSegments, ".*")
+			break
+		}
+
+		var regexSegment strings.Builder
+		for segment != "" {
+			loc := keyTemplateVariableRegex.FindStringSubmatchIndex(segment)
+			literal := segment
+			if loc != nil {
+				literal = segment[:loc[0]]
+			}
+			for i, part := range strings.Split(literal, "*") {
+				if i > 0 {
+					regexSegment.WriteString("[^/]*")
+				}
+				regexSegment.WriteString(regexp.QuoteMeta(part))
+			}
+			if loc == nil {
+				break
+			}
+			fmt.Fprintf(&regexSegment, "(?P<%s>[^/]*)", segment[loc[2]:loc[3]])
+			segment = segment[loc[1]:]
+		}
+		regexSegments = append(regexSegments, regexSegment.String())
+	}
+	return "^" + strings.Join(regexSegments, "/") + "$"
+}
+
+// validateKeyTemplate checks all variables of the template set in key are provided
+// by the object or keyPatterns.
+func validateKeyTemplate(key, template string, keyPatterns ...*regexp.Regexp) error {
+	variables := map[string]bool{bucketVariable: true, keyVariable: true, filenameVariable: true}
+	for _, keyPattern := range keyPatterns {
+		if keyPattern == nil {
+			continue
+		}
+		for _, name := range keyPattern.SubexpNames() {
+			if name != "" {
+				variables[name] = true
+			}
+		}
+	}
+
+	for _, match := range keyTemplateVariableRegex.FindAllStringSubmatch(template, -1) {
+		if !variables[match[1]] {
+			return fmt.Errorf("%s has unknown variable {%s}", key, match[1])
+		}
+	}
+	return nil
+}
+
+// keyVariables returns the variables available to templates for the object. Variables extracted by
+// a key pattern are empty if the key doesn't match it. Later patterns override variables of the same name.
+func keyVariables(bucket, key string, keyPatterns ...*regexp.Regexp) map[string]string {
+	variables := map[string]string{
+		bucketVariable:   bucket,
+		keyVariable:      key,
+		filenameVariable: path.Base(key),
+	}
+	for _, keyPattern := range keyPatterns {
+		if keyPattern == nil {
+			continue
+		}
+
+		match := keyPattern.FindStringSubmatch(key)
+		for i, name := range keyPattern.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			variables[name] = ""
+			if match != nil {
+				variables[name] = match[i]
+			}
+		}
+	}
+	return variables
+}
+
+// renderKeyTemplate replaces the {name} variables of template with their value.
+func renderKeyTemplate(template string, variables map[string]string) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+	return keyTemplateVariableRegex.ReplaceAllStringFunc(template, func(variable string) string {
+		return variables[variable[1:len(variable)-1]]
+	})
+}
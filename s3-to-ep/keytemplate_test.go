@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_keyVariables(t *testing.T) {
+	tests := []struct {
+		name              string
+		keyPattern        string
+		keyRegex          string
+		key               string
+		expectedVariables map[string]string
+	}{
+		{
+			name: "no pattern",
+			key:  "logs/app.log",
+			expectedVariables: map[string]string{
+				"bucket":   "test-bucket",
+				"key":      "logs/app.log",
+				"filename": "app.log",
+			},
+		},
+		{
+			name:       "key pattern",
+			keyPattern: "AWSLogs/{account}/{service}/{region}/...",
+			key:        "AWSLogs/123456789012/CloudTrail/us-west-2/2023/06/01/file.json.gz",
+			expectedVariables: map[string]string{
+				"bucket":   "test-bucket",
+				"key":      "AWSLogs/123456789012/CloudTrail/us-west-2/2023/06/01/file.json.gz",
+				"filename": "file.json.gz",
+				"account":  "123456789012",
+				"service":  "CloudTrail",
+				"region":   "us-west-2",
+			},
+		},
+		{
+			name:       "key pattern with wildcards and literals",
+			keyPattern: "*/host-{host}.log",
+			key:        "prod/host-web-1.log",
+			expectedVariables: map[string]string{
+				"bucket":   "test-bucket",
+				"key":      "prod/host-web-1.log",
+				"filename": "host-web-1.log",
+				"host":     "web-1",
+			},
+		},
+		{
+			name:       "key doesn't match the pattern",
+			keyPattern: "AWSLogs/{account}/...",
+			key:        "logs/app.log",
+			expectedVariables: map[string]string{
+				"bucket":   "test-bucket",
+				"key":      "logs/app.log",
+				"filename": "app.log",
+				"account":  "",
+			},
+		},
+		{
+			name:     "key regex",
+			keyRegex: `^(?P<env>[a-z]+)/(?P<app>[^/]+)/`,
+			key:      "prod/api/2023/app.log",
+			expectedVariables: map[string]string{
+				"bucket":   "test-bucket",
+				"key":      "prod/api/2023/app.log",
+				"filename": "app.log",
+				"env":      "prod",
+				"app":      "api",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyPattern, err := parseKeyPattern(tt.keyPattern, tt.keyRegex)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedVariables, keyVariables("test-bucket", tt.key, keyPattern))
+		})
+	}
+}
+
+func Test_parseKeyPattern_bothSet_error(t *testing.T) {
+	keyPattern, err := parseKeyPattern("logs/{app}/...", "^logs/(?P<app>[^/]+)/")
+	assert.EqualError(t, err, "only one of KEY_PATTERN and KEY_REGEX can be set")
+	assert.Nil(t, keyPattern)
+}
+
+func Test_renderKeyTemplate(t *testing.T) {
+	variables := map[string]string{"bucket": "test-bucket", "service": "CloudTrail"}
+	assert.Equal(t, "aws:CloudTrail", renderKeyTemplate("aws:{service}", variables))
+	assert.Equal(t, "test-bucket/", renderKeyTemplate("{bucket}/{missing}", variables))
+	assert.Equal(t, "archived_data", renderKeyTemplate("archived_data", variables))
+}
+
+func Test_buildPayloadBuilder_keyTemplates(t *testing.T) {
+	assert.NoError(t, os.Setenv(keyPatternEnvKey, "AWSLogs/{account}/{service}/{region}/..."))
+	assert.NoError(t, os.Setenv(hostEnvKey, "{account}"))
+	assert.NoError(t, os.Setenv(sourcetypeEnvKey, "aws:{service}"))
+	assert.NoError(t, os.Setenv(routingRulesEnvKey, `[{"key_regex": "^apps/(?P<app>[^/]+)/", "host": "{app}", "source": "{filename}"}]`))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(keyPatternEnvKey)
+		_ = os.Unsetenv(hostEnvKey)
+		_ = os.Unsetenv(sourcetypeEnvKey)
+		_ = os.Unsetenv(routingRulesEnvKey)
+	})
+	cfg := buildTestConfig(t)
+
+	record := buildTestRecord("AWSLogs/123456789012/CloudTrail/us-west-2/file.json.gz")
+	payloadBuilder := buildPayloadBuilder(cfg.route(record), record, buildLineBreaker(cfg), time.Time{})
+	assert.Equal(t, "123456789012", payloadBuilder.template.Host)
+	assert.Equal(t, "s3://test-bucket/AWSLogs/123456789012/CloudTrail/us-west-2/file.json.gz", payloadBuilder.template.Source)
+	assert.Equal(t, "aws:CloudTrail", payloadBuilder.template.Sourcetype)
+
+	// named groups of the matching rule are added to the key pattern variables
+	record = buildTestRecord("apps/api/app.log")
+	payloadBuilder = buildPayloadBuilder(cfg.route(record), record, buildLineBreaker(cfg), time.Time{})
+	assert.Equal(t, "api", payloadBuilder.template.Host)
+	assert.Equal(t, "app.log", payloadBuilder.template.Source)
+	assert.Equal(t, "aws:", payloadBuilder.template.Sourcetype)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	lineBreakerEnvKey     = "LINE_BREAKER"
+	shouldLineMergeEnvKey = "SHOULD_LINEMERGE"
+	breakOnlyBeforeEnvKey = "BREAK_ONLY_BEFORE"
+	maxEventSizeEnvKey    = "MAX_EVENT_SIZE"
+
+	defaultLineBreaker     = `([\r\n]+)`
+	defaultBreakOnlyBefore = `^\S`
+	defaultMaxEventSize    = 1024 * 1024
+
+	lineBreakerReadSize = 64 * 1024
+)
+
+// lineBreaker splits S3 content into individual events.
+// Content is first broken into lines by lineBreaker. The text matched by the first capturing group
+// of lineBreaker is discarded. If no capturing group is provided, the whole match is discarded.
+// If shouldLineMerge is set, lines are merged back together and a new event only starts
+// on lines matching breakOnlyBefore. This is useful for multi-line records such as stack traces.
+type lineBreaker struct {
+	lineBreaker     *regexp.Regexp
+	shouldLineMerge bool
+	breakOnlyBefore *regexp.Regexp
+	maxEventSize    int
+}
+
+func buildLineBreaker(cfg *Config) *lineBreaker {
+	return &lineBreaker{
+		lineBreaker:     cfg.LineBreaker,
+		shouldLineMerge: cfg.ShouldLineMerge,
+		breakOnlyBefore: cfg.BreakOnlyBefore,
+		maxEventSize:    cfg.MaxEventSize,
+	}
+}
+
+func (l *lineBreaker) decode(reader io.Reader, emit func(event decodedEvent) error) error {
+	return l.breakEvents(reader, func(event string) error {
+		return emit(decodedEvent{content: event})
+	})
+}
+
+// breakEvents reads content from reader and calls emit for every event.
+// Content is read in chunks so memory usage is bounded by maxEventSize regardless of the content size.
+func (l *lineBreaker) breakEvents(reader io.Reader, emit func(event string) error) error {
+	state := &lineBreakerState{
+		breaker: l,
+		emit:    emit,
+	}
+
+	chunk := make([]byte, lineBreakerReadSize)
+	var buf []byte
+	for {
+		n, readErr := reader.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+
+		isEOF := readErr == io.EOF
+		if readErr != nil && !isEOF {
+			return readErr
+		}
+
+		consumed, err := state.splitLines(buf, isEOF)
+		if err != nil {
+			return err
+		}
+		buf = append(buf[:0], buf[consumed:]...)
+
+		if isEOF {
+			return state.flush()
+		}
+	}
+}
+
+// lineBreakerState keeps track of lines and events across chunks of content.
+type lineBreakerState struct {
+	breaker *lineBreaker
+	emit    func(event string) error
+
+	// discardLine is set when the current line was truncated and the rest of it needs to be dropped
+	discardLine bool
+	// merged holds the event being merged when shouldLineMerge is set
+	merged strings.Builder
+}
+
+// splitLines emits complete lines found in buf and returns the number of bytes consumed.
+// Unless it is the end of the content, a line break at the end of buf is kept as it could match more content.
+func (s *lineBreakerState) splitLines(buf []byte, isEOF bool) (int, error) {
+	start := 0
+	for _, match := range s.breaker.lineBreaker.FindAllSubmatchIndex(buf, -1) {
+		if !isEOF && match[1] == len(buf) {
+			break
+		}
+
+		// discard the first capturing group if present, otherwise the whole match
+		breakStart, breakEnd := match[0], match[1]
+		if len(match) > 2 && match[2] >= 0 {
+			breakStart, breakEnd = match[2], match[3]
+		}
+		if breakEnd == breakStart {
+			continue
+		}
+		if err := s.addLine(string(buf[start:breakStart])); err != nil {
+			return 0, err
+		}
+		start = breakEnd
+	}
+
+	if isEOF {
+		return len(buf), s.addLine(string(buf[start:]))
+	}
+
+	// the current line is too big. Truncate it and drop the rest until the next line break
+	if len(buf)-start > s.breaker.maxEventSize {
+		if err := s.addLine(string(buf[start:])); err != nil {
+			return 0, err
+		}
+		s.discardLine = true
+		return len(buf), nil
+	}
+	return start, nil
+}
+
+func (s *lineBreakerState) addLine(line string) error {
+	if s.discardLine {
+		s.discardLine = false
+		return nil
+	}
+
+	if !s.breaker.shouldLineMerge {
+		if strings.TrimSpace(line) == "" {
+			return nil
+		}
+		return s.emit(truncateEvent(line, s.breaker.maxEventSize))
+	}
+
+	if line == "" {
+		return nil
+	}
+	if s.merged.Len() > 0 && s.breaker.breakOnlyBefore.MatchString(line) {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	// lines exceeding max event size would be truncated anyway
+	if s.merged.Len() > s.breaker.maxEventSize {
+		return nil
+	}
+	if s.merged.Len() > 0 {
+		s.merged.WriteString("\n")
+	}
+	s.merged.WriteString(line)
+	return nil
+}
+
+func (s *lineBreakerState) flush() error {
+	if s.merged.Len() == 0 {
+		return nil
+	}
+	event := s.merged.String()
+	s.merged.Reset()
+
+	if strings.TrimSpace(event) == "" {
+		return nil
+	}
+	return s.emit(truncateEvent(event, s.breaker.maxEventSize))
+}
+
+// truncateEvent guards against events bigger than maxEventSize without breaking multibyte characters.
+func truncateEvent(event string, maxEventSize int) string {
+	if len(event) <= maxEventSize {
+		return event
+	}
+
+	log.Printf("event size %d exceeds max event size %d. Truncating event", len(event), maxEventSize)
+	cut := maxEventSize
+	for cut > 0 && !utf8.RuneStart(event[cut]) {
+		cut--
+	}
+	return event[:cut]
+}
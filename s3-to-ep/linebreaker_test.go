@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectEvents(t *testing.T, breaker *lineBreaker, reader io.Reader) []string {
+	var events []string
+	err := breaker.breakEvents(reader, func(event string) error {
+		events = append(events, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	return events
+}
+
+func Test_buildLineBreaker_noEnvSet_useDefault(t *testing.T) {
+	breaker := buildLineBreaker(buildTestConfig(t))
+	assert.Equal(t, defaultLineBreaker, breaker.lineBreaker.String())
+	assert.Equal(t, defaultBreakOnlyBefore, breaker.breakOnlyBefore.String())
+	assert.False(t, breaker.shouldLineMerge)
+	assert.Equal(t, defaultMaxEventSize, breaker.maxEventSize)
+}
+
+func Test_lineBreaker_breakEvents(t *testing.T) {
+	const stackTrace = "2023-06-01 12:00:00 ERROR request failed\n" +
+		"java.lang.IllegalStateException: boom\n" +
+		"\tat com.example.Foo.bar(Foo.java:10)\n" +
+		"\tat com.example.Foo.main(Foo.java:5)\n" +
+		"2023-06-01 12:00:01 INFO request succeeded\n"
+
+	tests := []struct {
+		name           string
+		envs           map[string]string
+		content        string
+		expectedEvents []string
+	}{
+		{
+			name:           "break by newline by default",
+			content:        "line1\nline2\r\nline3\n\n",
+			expectedEvents: []string{"line1", "line2", "line3"},
+		},
+		{
+			name: "break by custom regex capturing group",
+			envs: map[string]string{
+				lineBreakerEnvKey: `(;)\d`,
+			},
+			content:        "1a;2b;3c",
+			expectedEvents: []string{"1a", "2b", "3c"},
+		},
+		{
+			name: "break by custom regex without capturing group",
+			envs: map[string]string{
+				lineBreakerEnvKey: `\|\|`,
+			},
+			content:        "a||b||c",
+			expectedEvents: []string{"a", "b", "c"},
+		},
+		{
+			name: "merge lines with default break only before",
+			envs: map[string]string{
+				shouldLineMergeEnvKey: "true",
+			},
+			content: "first\n\tcontinued\nsecond\n",
+			expectedEvents: []string{
+				"first\n\tcontinued",
+				"second",
+			},
+		},
+		{
+			name: "merge stack trace lines by date",
+			envs: map[string]string{
+				shouldLineMergeEnvKey: "true",
+				breakOnlyBeforeEnvKey: `^\d{4}-\d{2}-\d{2}`,
+			},
+			content: stackTrace,
+			expectedEvents: []string{
+				strings.Join(strings.Split(stackTrace, "\n")[:4], "\n"),
+				"2023-06-01 12:00:01 INFO request succeeded",
+			},
+		},
+		{
+			name: "truncate events exceeding max event size",
+			envs: map[string]string{
+				maxEventSizeEnvKey: "5",
+			},
+			content:        "123456789\nabc\nd€€f",
+			expectedEvents: []string{"12345", "abc", "d€"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, val := range tt.envs {
+				assert.NoError(t, os.Setenv(key, val))
+			}
+			t.Cleanup(func() {
+				for key := range tt.envs {
+					_ = os.Unsetenv(key)
+				}
+			})
+
+			breaker := buildLineBreaker(buildTestConfig(t))
+			assert.Equal(t, tt.expectedEvents, collectEvents(t, breaker, strings.NewReader(tt.content)))
+		})
+	}
+}
+
+func Test_lineBreaker_breakEvents_contentBiggerThanReadSize(t *testing.T) {
+	const lineCount = 10000
+	line := strings.Repeat("x", 99)
+	content := strings.Repeat(line+"\n", lineCount)
+	assert.Greater(t, len(content), lineBreakerReadSize)
+
+	breaker := buildLineBreaker(buildTestConfig(t))
+
+	events := collectEvents(t, breaker, strings.NewReader(content))
+	assert.Len(t, events, lineCount)
+	for _, event := range events {
+		assert.Equal(t, line, event)
+	}
+}
+
+func Test_lineBreaker_breakEvents_lineBiggerThanMaxEventSize_truncated(t *testing.T) {
+	assert.NoError(t, os.Setenv(maxEventSizeEnvKey, "10"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(maxEventSizeEnvKey)
+	})
+
+	breaker := buildLineBreaker(buildTestConfig(t))
+
+	bigLine := strings.Repeat("a", 3*lineBreakerReadSize)
+	content := "first\n" + bigLine + "\nlast"
+	events := collectEvents(t, breaker, strings.NewReader(content))
+	assert.Equal(t, []string{"first", "aaaaaaaaaa", "last"}, events)
+}
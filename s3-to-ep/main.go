@@ -2,86 +2,172 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"strings"
+	"os"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
 const (
 	httpContentEncodingHeader = "Content-Encoding"
 	httpContentTypeHeader     = "Content-Type"
+	httpAuthorizationHeader   = "Authorization"
 	contentType               = "application/json"
 	folderSuffix              = "/"
+
+	s3EventSource  = "aws:s3"
+	sqsEventSource = "aws:sqs"
+	snsEventSource = "aws:sns"
 )
 
-func handleS3Record(ctx context.Context, s3Client S3Client, httpClient *http.Client, record events.S3EventRecord) error {
-	// ignore folders
-	if strings.HasSuffix(record.S3.Object.Key, folderSuffix) {
-		return nil
-	}
+// recordError is the error of a single S3 record.
+type recordError struct {
+	bucket string
+	key    string
+	err    error
+}
 
-	s3ContentBytes, err := fetchS3Content(ctx, s3Client, record)
-	if err != nil {
-		log.Printf("error fetching s3 object: %s", err)
-		return err
-	}
+func (e *recordError) Error() string {
+	return fmt.Sprintf("s3://%s/%s: %s", e.bucket, e.key, e.err)
+}
 
-	// TODO: combine multiple events into a batch to send together
-	httpReq, err := buildHTTPReq(record, string(s3ContentBytes))
-	if err != nil {
-		log.Printf("error building http request: %s", err)
-		return err
+func (e *recordError) Unwrap() error {
+	return e.err
+}
+
+// getRecordID identifies the object version of a record. Duplicated notifications share the same id.
+func getRecordID(record events.S3EventRecord) string {
+	return fmt.Sprintf("s3://%s/%s?versionId=%s&sequencer=%s", record.S3.Bucket.Name, getObjectKey(record),
+		record.S3.Object.VersionID, record.S3.Object.Sequencer)
+}
+
+// buildRecordsError aggregates the errors of failed records. It returns nil if all records succeeded.
+func buildRecordsError(records []events.S3EventRecord, errs []error) error {
+	var recordErrs []error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		recordErrs = append(recordErrs, &recordError{
+			bucket: records[i].S3.Bucket.Name,
+			key:    getObjectKey(records[i]),
+			err:    err,
+		})
 	}
 
-	res, err := httpClient.Do(httpReq)
-	if err != nil {
-		log.Printf("error making http call: %s", err)
-		return err
+	if len(recordErrs) == 0 {
+		return nil
 	}
+	return fmt.Errorf("failed to process %d of %d records:\n%w", len(recordErrs), len(records), errors.Join(recordErrs...))
+}
 
-	// TODO: we can retry 500s errors with exponential backoffs
-	if res.StatusCode >= 400 && res.StatusCode < 600 {
-		var responseBody string
-		if resBodyBytes, err := io.ReadAll(res.Body); err == nil {
-			responseBody = string(resBodyBytes)
-		}
-		err = fmt.Errorf("http response was not successful. Status code: %d, Response Body: %s", res.StatusCode, responseBody)
-		return err
+// handler holds the clients and configuration shared by all invocations of a Lambda execution environment.
+// It is built once at cold start so warm invocations reuse connections to S3 and EP.
+type handler struct {
+	processor *recordsProcessor
+}
+
+func newHandler(cfg *Config, s3Client S3Client, httpClient *http.Client, secretsClient SecretsManagerClient) *handler {
+	processor := newRecordsProcessor(cfg, s3Client, httpClient)
+	if cfg.hasSecrets() {
+		processor.secrets = newSecretsResolver(cfg, httpClient, secretsClient)
 	}
-	return nil
+	return &handler{processor: processor}
 }
 
-func S3Handler(ctx context.Context, s3Event events.S3Event) error {
+func buildHandler(ctx context.Context) (*handler, error) {
 	sdkConfig, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		log.Printf("failed to load default config: %s", err)
-		return err
+		return nil, err
 	}
 	s3Client := s3.NewFromConfig(sdkConfig)
 
-	httpClient, err := buildHTTPClient()
+	cfg, err := loadConfigFromSources(ctx, os.Getenv, s3Client, ssm.NewFromConfig(sdkConfig))
 	if err != nil {
-		log.Printf("error building http client: %s", err)
-		return err
+		log.Printf("invalid configuration:\n%s", err)
+		return nil, err
+	}
+	h := newHandler(cfg, s3Client, buildHTTPClient(cfg), secretsmanager.NewFromConfig(sdkConfig))
+	// fail at cold start if secrets can't be resolved
+	if _, _, err = h.processor.connection(ctx); err != nil {
+		log.Printf("error resolving secrets: %s", err)
+		return nil, err
 	}
+	return h, nil
+}
 
+func (h *handler) S3Handler(ctx context.Context, s3Event events.S3Event) error {
 	log.Printf("receiving S3 Event records. Count: %d", len(s3Event.Records))
-	for _, record := range s3Event.Records {
-		if err = handleS3Record(ctx, s3Client, httpClient, record); err != nil {
-			return err
+	errs := h.processor.process(ctx, s3Event.Records)
+	return buildRecordsError(s3Event.Records, errs)
+}
+
+// LambdaHandler detects the type of the lambda event and dispatches it to the matching handler.
+func (h *handler) LambdaHandler(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var probe struct {
+		Source  string `json:"source"`
+		Records []struct {
+			EventSource string `json:"eventSource"`
+		} `json:"Records"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return nil, fmt.Errorf("lambda event is not valid json: %w", err)
+	}
+
+	if probe.Source != "" {
+		records, err := parseS3Notification(payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return nil, nil
 		}
+		return nil, h.S3Handler(ctx, events.S3Event{Records: records})
 	}
 
-	return nil
+	var eventSource string
+	if len(probe.Records) > 0 {
+		eventSource = probe.Records[0].EventSource
+	}
+
+	switch eventSource {
+	case sqsEventSource:
+		var sqsEvent events.SQSEvent
+		if err := json.Unmarshal(payload, &sqsEvent); err != nil {
+			return nil, err
+		}
+		return h.SQSHandler(ctx, sqsEvent)
+	case snsEventSource:
+		var snsEvent events.SNSEvent
+		if err := json.Unmarshal(payload, &snsEvent); err != nil {
+			return nil, err
+		}
+		return nil, h.SNSHandler(ctx, snsEvent)
+	case s3EventSource, "":
+		var s3Event events.S3Event
+		if err := json.Unmarshal(payload, &s3Event); err != nil {
+			return nil, err
+		}
+		return nil, h.S3Handler(ctx, s3Event)
+	default:
+		return nil, fmt.Errorf("event source %s is not supported", eventSource)
+	}
 }
 
 func main() {
-	lambda.Start(S3Handler)
+	h, err := buildHandler(context.Background())
+	if err != nil {
+		log.Fatalf("error initializing lambda handler: %s", err)
+	}
+	lambda.Start(h.LambdaHandler)
 }
@@ -2,94 +2,112 @@ package main
 
 import (
 	"context"
-	"io"
+	"encoding/json"
 	"net/http"
 	"os"
-	"strings"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
 )
 
-func Test_handleS3Record_folderEventsAreIgnored(t *testing.T) {
-	record := events.S3EventRecord{
-		S3: events.S3Entity{
-			Bucket: events.S3Bucket{
-				Name: "test-bucket",
-			},
-			Object: events.S3Object{
-				Key: "test-key/",
-			},
+func newTestHandler(t *testing.T) *handler {
+	return newHandler(buildTestConfig(t), &objectsTestS3Client{}, &http.Client{}, &mapTestSecretsManagerClient{})
+}
+
+func Test_LambdaHandler_unsupportedEvent_error(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{
+			name:    "invalid json",
+			payload: "not json",
+		},
+		{
+			name:    "unsupported event source",
+			payload: `{"Records":[{"eventSource":"aws:dynamodb"}]}`,
 		},
 	}
-	s3Client := &staticTestS3Client{}
-	err := handleS3Record(context.Background(), s3Client, nil, record)
-	assert.NoError(t, err)
-	assert.Nil(t, s3Client.params)
-}
 
-func Test_handleS3Record_hecIngestionSuccess(t *testing.T) {
-	const (
-		s3Content = "test-content"
-		testURL   = "http://localhost/services/collector"
-	)
-	assert.NoError(t, os.Setenv(epHostEnvKey, testURL))
-	t.Cleanup(func() {
-		_ = os.Unsetenv(epHostEnvKey)
-	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := newTestHandler(t).LambdaHandler(context.Background(), json.RawMessage(tt.payload))
+			assert.Error(t, err)
+			assert.Nil(t, res)
+		})
+	}
+}
 
-	record := events.S3EventRecord{
-		S3: events.S3Entity{
-			Bucket: events.S3Bucket{
-				Name: "test-bucket",
-			},
-			Object: events.S3Object{
-				Key: "test-key",
+func Test_LambdaHandler_sqsTestEvent_noFailures(t *testing.T) {
+	sqsEvent := events.SQSEvent{
+		Records: []events.SQSMessage{
+			{
+				MessageId:   "test-event",
+				EventSource: sqsEventSource,
+				Body:        `{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"test-bucket"}`,
 			},
 		},
 	}
-	s3Client := &staticTestS3Client{
-		output: &s3.GetObjectOutput{
-			Body: io.NopCloser(strings.NewReader(s3Content)),
+	payload, err := json.Marshal(sqsEvent)
+	assert.NoError(t, err)
+
+	res, err := newTestHandler(t).LambdaHandler(context.Background(), payload)
+	assert.NoError(t, err)
+	assert.Equal(t, events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}, res)
+}
+
+func Test_LambdaHandler_testEvents_noRecordsHandled(t *testing.T) {
+	snsEvent := events.SNSEvent{
+		Records: []events.SNSEventRecord{
+			{
+				EventSource: snsEventSource,
+				SNS: events.SNSEntity{
+					MessageID: "test-message",
+					Message:   `{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"test-bucket"}`,
+				},
+			},
 		},
 	}
+	snsPayload, err := json.Marshal(snsEvent)
+	assert.NoError(t, err)
 
 	tests := []struct {
-		name               string
-		httpResponseStatus int
-		expectedErr        bool
+		name    string
+		payload json.RawMessage
 	}{
 		{
-			name:               "hec event ingestion was successful",
-			httpResponseStatus: 200,
+			name:    "sns s3 test event",
+			payload: snsPayload,
 		},
 		{
-			name:               "hec event ingestion ran into server error",
-			httpResponseStatus: 500,
-			expectedErr:        true,
+			name:    "eventbridge object deleted event",
+			payload: json.RawMessage(`{"detail-type":"Object Deleted","source":"aws.s3","detail":{"bucket":{"name":"test-bucket"},"object":{"key":"test-key"}}}`),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			httpmock.Activate()
-			defer httpmock.DeactivateAndReset()
-
-			httpmock.RegisterResponder(http.MethodPost, testURL, func(_ *http.Request) (*http.Response, error) {
-				return httpmock.NewJsonResponse(tt.httpResponseStatus, map[string]interface{}{
-					"mockResponse": "",
-				})
-			})
-
-			err := handleS3Record(context.Background(), s3Client, &http.Client{}, record)
-			if tt.expectedErr {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-			}
+			res, err := newTestHandler(t).LambdaHandler(context.Background(), tt.payload)
+			assert.NoError(t, err)
+			assert.Nil(t, res)
 		})
 	}
 }
+
+func Test_buildRecordsError_allSucceeded_noError(t *testing.T) {
+	records := []events.S3EventRecord{{}, {}}
+	assert.NoError(t, buildRecordsError(records, make([]error, len(records))))
+}
+
+func Test_buildHandler_invalidConfig_error(t *testing.T) {
+	assert.NoError(t, os.Setenv(maxConcurrencyEnvKey, "0"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(maxConcurrencyEnvKey)
+	})
+
+	h, err := buildHandler(context.Background())
+	assert.ErrorContains(t, err, epHostEnvKey)
+	assert.ErrorContains(t, err, maxConcurrencyEnvKey)
+	assert.Nil(t, h)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	s3TestEvent              = "s3:TestEvent"
+	snsNotificationType      = "Notification"
+	eventBridgeS3Source      = "aws.s3"
+	eventBridgeObjectCreated = "Object Created"
+)
+
+// s3Notification covers all the payloads S3 events can be delivered with:
+//   - S3 event notifications. S3 sends a test message with Event set to s3:TestEvent when notifications are configured.
+//   - SNS notifications with the S3 event notification in Message.
+//   - EventBridge events from aws.s3 with the object in Detail.
+type s3Notification struct {
+	Event   string                 `json:"Event"`
+	Records []events.S3EventRecord `json:"Records"`
+
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+
+	Source     string          `json:"source"`
+	DetailType string          `json:"detail-type"`
+	Time       time.Time       `json:"time"`
+	Region     string          `json:"region"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+type eventBridgeS3Detail struct {
+	Bucket struct {
+		Name string `json:"name"`
+	} `json:"bucket"`
+	Object struct {
+		Key       string `json:"key"`
+		Size      int64  `json:"size"`
+		ETag      string `json:"etag"`
+		VersionID string `json:"version-id"`
+		Sequencer string `json:"sequencer"`
+	} `json:"object"`
+	Reason string `json:"reason"`
+}
+
+// parseS3Notification extracts S3 event records from a notification payload, unwrapping SNS notifications
+// and normalizing EventBridge events into S3 event records.
+func parseS3Notification(payload []byte) ([]events.S3EventRecord, error) {
+	var notification s3Notification
+	if err := json.Unmarshal(payload, &notification); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case notification.Type == snsNotificationType:
+		return parseS3Notification([]byte(notification.Message))
+	case notification.Source == eventBridgeS3Source:
+		return parseEventBridgeS3Event(notification)
+	case notification.Source != "":
+		return nil, fmt.Errorf("eventbridge event source %s is not supported", notification.Source)
+	case notification.Event == s3TestEvent:
+		log.Printf("ignoring s3 test event")
+		return nil, nil
+	default:
+		return notification.Records, nil
+	}
+}
+
+func parseEventBridgeS3Event(notification s3Notification) ([]events.S3EventRecord, error) {
+	if notification.DetailType != eventBridgeObjectCreated {
+		log.Printf("ignoring eventbridge event of type %s", notification.DetailType)
+		return nil, nil
+	}
+
+	var detail eventBridgeS3Detail
+	if err := json.Unmarshal(notification.Detail, &detail); err != nil {
+		return nil, err
+	}
+
+	return []events.S3EventRecord{
+		{
+			EventSource: s3EventSource,
+			AWSRegion:   notification.Region,
+			EventTime:   notification.Time,
+			EventName:   notification.DetailType + ":" + detail.Reason,
+			S3: events.S3Entity{
+				Bucket: events.S3Bucket{
+					Name: detail.Bucket.Name,
+				},
+				Object: events.S3Object{
+					// eventbridge keys aren't url encoded
+					Key:           detail.Object.Key,
+					URLDecodedKey: detail.Object.Key,
+					Size:          detail.Object.Size,
+					ETag:          detail.Object.ETag,
+					VersionID:     detail.Object.VersionID,
+					Sequencer:     detail.Object.Sequencer,
+				},
+			},
+		},
+	}, nil
+}
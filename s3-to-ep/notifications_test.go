@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testS3NotificationBody = `{"Records":[{"eventSource":"aws:s3","eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"test-bucket"},"object":{"key":"logs/test+file.log","size":10}}}]}`
+	testS3TestEventBody    = `{"Service":"Amazon S3","Event":"s3:TestEvent","Time":"2023-06-01T12:00:00.000Z","Bucket":"test-bucket"}`
+	testEventBridgeBody    = `{"version":"0","id":"test-id","detail-type":"Object Created","source":"aws.s3","account":"123456789012","time":"2023-06-01T12:00:00Z","region":"us-west-2","resources":["arn:aws:s3:::test-bucket"],"detail":{"version":"0","bucket":{"name":"test-bucket"},"object":{"key":"logs/test file.log","size":10,"etag":"test-etag","sequencer":"test-sequencer"},"request-id":"test-request","requester":"123456789012","reason":"PutObject"}}`
+)
+
+func buildTestSNSNotificationBody(t *testing.T, message string) string {
+	body, err := json.Marshal(map[string]string{
+		"Type":      snsNotificationType,
+		"MessageId": "test-message",
+		"TopicArn":  "arn:aws:sns:us-west-2:123456789012:test-topic",
+		"Message":   message,
+	})
+	assert.NoError(t, err)
+	return string(body)
+}
+
+func Test_parseS3Notification(t *testing.T) {
+	tests := []struct {
+		name         string
+		payload      string
+		expectedKeys []string
+	}{
+		{
+			name:         "s3 event notification",
+			payload:      testS3NotificationBody,
+			expectedKeys: []string{"logs/test file.log"},
+		},
+		{
+			name:    "s3 test event",
+			payload: testS3TestEventBody,
+		},
+		{
+			name:         "sns wrapped s3 event notification",
+			payload:      buildTestSNSNotificationBody(t, testS3NotificationBody),
+			expectedKeys: []string{"logs/test file.log"},
+		},
+		{
+			name:    "sns wrapped s3 test event",
+			payload: buildTestSNSNotificationBody(t, testS3TestEventBody),
+		},
+		{
+			name:         "eventbridge object created event",
+			payload:      testEventBridgeBody,
+			expectedKeys: []string{"logs/test file.log"},
+		},
+		{
+			name:         "sns wrapped eventbridge event",
+			payload:      buildTestSNSNotificationBody(t, testEventBridgeBody),
+			expectedKeys: []string{"logs/test file.log"},
+		},
+		{
+			name:    "eventbridge object deleted event is ignored",
+			payload: `{"detail-type":"Object Deleted","source":"aws.s3","detail":{"bucket":{"name":"test-bucket"},"object":{"key":"test-key"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := parseS3Notification([]byte(tt.payload))
+			assert.NoError(t, err)
+
+			var keys []string
+			for _, record := range records {
+				assert.Equal(t, "test-bucket", record.S3.Bucket.Name)
+				keys = append(keys, getObjectKey(record))
+			}
+			assert.Equal(t, tt.expectedKeys, keys)
+		})
+	}
+}
+
+func Test_parseS3Notification_eventBridgeNormalized(t *testing.T) {
+	records, err := parseS3Notification([]byte(testEventBridgeBody))
+	assert.NoError(t, err)
+	assert.Equal(t, []events.S3EventRecord{
+		{
+			EventSource: s3EventSource,
+			AWSRegion:   "us-west-2",
+			EventTime:   time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+			EventName:   "Object Created:PutObject",
+			S3: events.S3Entity{
+				Bucket: events.S3Bucket{
+					Name: "test-bucket",
+				},
+				Object: events.S3Object{
+					Key:           "logs/test file.log",
+					URLDecodedKey: "logs/test file.log",
+					Size:          10,
+					ETag:          "test-etag",
+					Sequencer:     "test-sequencer",
+				},
+			},
+		},
+	}, records)
+}
+
+func Test_parseS3Notification_error(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{
+			name:    "invalid json",
+			payload: "not json",
+		},
+		{
+			name:    "sns message is invalid json",
+			payload: buildTestSNSNotificationBody(t, "not json"),
+		},
+		{
+			name:    "unsupported eventbridge source",
+			payload: `{"detail-type":"EC2 Instance State-change Notification","source":"aws.ec2","detail":{}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := parseS3Notification([]byte(tt.payload))
+			assert.Error(t, err)
+			assert.Nil(t, records)
+		})
+	}
+}
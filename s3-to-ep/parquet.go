@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+const (
+	parquetTimestampColumnEnvKey = "PARQUET_TIMESTAMP_COLUMN"
+
+	// parquetReadBufferSize is the size of the ranged reads of column chunks
+	parquetReadBufferSize = 1 << 20
+	parquetRowBatchSize   = 128
+
+	// julianDayOfUnixEpoch is the julian day of 1970-01-01, used by INT96 timestamps
+	julianDayOfUnixEpoch = 2440588
+	parquetDateLayout    = "2006-01-02"
+)
+
+var parquetMagicBytes = []byte("PAR1")
+
+var parquetKeyRegex = regexp.MustCompile(`\.parquet$`)
+
+// parquetEventDecoder decodes Parquet files, which are read with random access as their metadata
+// is at the end of the file.
+type parquetEventDecoder interface {
+	decodeParquet(file *parquet.File, emit func(event decodedEvent) error) error
+}
+
+// isParquetObject is true if the object is read with random access by a parquetEventDecoder
+// instead of being streamed.
+func isParquetObject(cfg *Config, objectKey string) bool {
+	return cfg.Decoder == parquetDecoderName || parquetKeyRegex.MatchString(objectKey)
+}
+
+// openParquetFile opens a Parquet file. Page indexes and bloom filters are skipped as all rows are read.
+func openParquetFile(object io.ReaderAt, size int64) (*parquet.File, error) {
+	file, err := parquet.OpenFile(object, size,
+		parquet.ReadBufferSize(parquetReadBufferSize),
+		parquet.SkipPageIndex(true),
+		parquet.SkipBloomFilters(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parquet file: %w", err)
+	}
+	return file, nil
+}
+
+// errStreamedParquetContent is returned when Parquet content is streamed. Parquet objects are read with
+// ranged requests so they are never held in memory.
+var errStreamedParquetContent = errors.New("parquet content can't be streamed, it must be read with ranged requests")
+
+// readParquetRows calls readRow with each row of file. Rows are only valid until readRow returns.
+func readParquetRows(file *parquet.File, readRow func(row parquet.Row) error) error {
+	batch := make([]parquet.Row, parquetRowBatchSize)
+	for _, rowGroup := range file.RowGroups() {
+		if err := readParquetRowGroup(rowGroup, batch, readRow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readParquetRowGroup(rowGroup parquet.RowGroup, batch []parquet.Row, readRow func(row parquet.Row) error) error {
+	rows := rowGroup.Rows()
+	defer rows.Close()
+
+	for {
+		n, err := rows.ReadRows(batch)
+		for _, row := range batch[:n] {
+			if readErr := readRow(row); readErr != nil {
+				return readErr
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid parquet file: %w", err)
+		}
+	}
+}
+
+// parquetDecoder emits each row of a Parquet file as a JSON object following the file schema.
+// The time of events is the value of timestampColumn, a dot separated column path, if set.
+// Timestamp columns are used as is, other columns are parsed with timestamps.
+type parquetDecoder struct {
+	timestampColumn string
+	timestamps      *timestampExtractor
+}
+
+func (d *parquetDecoder) decode(_ io.Reader, _ func(event decodedEvent) error) error {
+	return errStreamedParquetContent
+}
+
+func (d *parquetDecoder) decodeParquet(file *parquet.File, emit func(event decodedEvent) error) error {
+	writer := newParquetRowWriter(file.Schema(), d.timestampColumn)
+	return readParquetRows(file, func(row parquet.Row) error {
+		content, timestampValue, timestampNode := writer.write(row)
+		event := decodedEvent{content: content}
+		if timestampNode != nil {
+			event.time, _ = d.parseTime(timestampNode, timestampValue)
+		}
+		return emit(event)
+	})
+}
+
+func (d *parquetDecoder) parseTime(node *parquetNode, value parquet.Value) (time.Time, bool) {
+	if timestamp, isTime := parquetValueTime(node.node, value); isTime {
+		return timestamp, true
+	}
+	return d.timestamps.parse(strings.TrimSpace(value.String()))
+}
+
+// parquetNode is a node of the file schema with the levels at which it is defined and repeated.
+// columns are the indexes of the leaf columns under the node.
+type parquetNode struct {
+	name            string
+	path            string
+	node            parquet.Node
+	definitionLevel int
+	repetitionLevel int
+	columns         []int
+	fields          []*parquetNode
+}
+
+func buildParquetNode(schema *parquet.Schema, name string, path []string, node parquet.Node, definitionLevel, repetitionLevel int) *parquetNode {
+	if node.Optional() || node.Repeated() {
+		definitionLevel++
+	}
+	if node.Repeated() {
+		repetitionLevel++
+	}
+	n := &parquetNode{
+		name:            name,
+		path:            strings.Join(path, "."),
+		node:            node,
+		definitionLevel: definitionLevel,
+		repetitionLevel: repetitionLevel,
+	}
+
+	if node.Leaf() {
+		if column, found := schema.Lookup(path...); found {
+			n.columns = []int{column.ColumnIndex}
+		}
+		return n
+	}
+	for _, field := range node.Fields() {
+		fieldPath := append(append([]string{}, path...), field.Name())
+		fieldNode := buildParquetNode(schema, field.Name(), fieldPath, field, definitionLevel, repetitionLevel)
+		n.fields = append(n.fields, fieldNode)
+		n.columns = append(n.columns, fieldNode.columns...)
+	}
+	return n
+}
+
+// parquetRowWriter writes rows as JSON objects. Values of each column are read in order, nested
+// values being assembled from their definition and repetition levels. Null fields are left out.
+type parquetRowWriter struct {
+	root            *parquetNode
+	timestampColumn string
+	columnValues    [][]parquet.Value
+	positions       []int
+
+	timestampValue parquet.Value
+	timestampNode  *parquetNode
+}
+
+func newParquetRowWriter(schema *parquet.Schema, timestampColumn string) *parquetRowWriter {
+	numColumns := len(schema.Columns())
+	return &parquetRowWriter{
+		root:            buildParquetNode(schema, "", nil, schema, 0, 0),
+		timestampColumn: timestampColumn,
+		columnValues:    make([][]parquet.Value, numColumns),
+		positions:       make([]int, numColumns),
+	}
+}
+
+// write returns the row as a JSON object and the value of the timestamp column, if not null.
+func (w *parquetRowWriter) write(row parquet.Row) (string, parquet.Value, *parquetNode) {
+	for i := range w.columnValues {
+		w.columnValues[i] = nil
+		w.positions[i] = 0
+	}
+	row.Range(func(columnIndex int, columnValues []parquet.Value) bool {
+		if columnIndex < len(w.columnValues) {
+			w.columnValues[columnIndex] = columnValues
+		}
+		return true
+	})
+	w.timestampValue, w.timestampNode = parquet.Value{}, nil
+
+	var buf bytes.Buffer
+	w.writeGroup(&buf, w.root)
+	return buf.String(), w.timestampValue, w.timestampNode
+}
+
+// peek returns the next value of the first column under n, which tells if n is null or repeated.
+func (w *parquetRowWriter) peek(n *parquetNode) (parquet.Value, bool) {
+	if len(n.columns) == 0 {
+		return parquet.Value{}, false
+	}
+	column := n.columns[0]
+	if w.positions[column] >= len(w.columnValues[column]) {
+		return parquet.Value{}, false
+	}
+	return w.columnValues[column][w.positions[column]], true
+}
+
+// skip consumes the value written in each column under n for a null or empty n.
+func (w *parquetRowWriter) skip(n *parquetNode) {
+	for _, column := range n.columns {
+		w.positions[column]++
+	}
+}
+
+// isNull is true if n has no value, in which case its values are consumed.
+func (w *parquetRowWriter) isNull(n *parquetNode) bool {
+	value, found := w.peek(n)
+	if !found {
+		return true
+	}
+	if (n.node.Optional() || n.node.Repeated()) && value.DefinitionLevel() < n.definitionLevel {
+		w.skip(n)
+		return true
+	}
+	return false
+}
+
+// writeNode writes a field. Repeated fields are written as arrays.
+func (w *parquetRowWriter) writeNode(buf *bytes.Buffer, n *parquetNode) {
+	if !n.node.Repeated() {
+		w.writeValue(buf, n)
+		return
+	}
+	buf.WriteByte('[')
+	w.writeRepeated(n, func(i int) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		w.writeValue(buf, n)
+	})
+	buf.WriteByte(']')
+}
+
+// writeRepeated calls writeElement for each element of the repeated node n.
+func (w *parquetRowWriter) writeRepeated(n *parquetNode, writeElement func(i int)) {
+	if w.isNull(n) {
+		return
+	}
+	for i := 0; ; i++ {
+		writeElement(i)
+		value, found := w.peek(n)
+		if !found || value.RepetitionLevel() != n.repetitionLevel {
+			return
+		}
+	}
+}
+
+func (w *parquetRowWriter) writeValue(buf *bytes.Buffer, n *parquetNode) {
+	switch {
+	case n.node.Leaf():
+		w.writeLeaf(buf, n)
+	case isParquetList(n):
+		w.writeList(buf, n)
+	case isParquetMap(n):
+		w.writeMap(buf, n)
+	default:
+		w.writeGroup(buf, n)
+	}
+}
+
+func (w *parquetRowWriter) writeGroup(buf *bytes.Buffer, n *parquetNode) {
+	buf.WriteByte('{')
+	written := 0
+	for _, field := range n.fields {
+		if !field.node.Repeated() && w.isNull(field) {
+			continue
+		}
+		if written > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(buf, field.name)
+		buf.WriteByte(':')
+		w.writeNode(buf, field)
+		written++
+	}
+	buf.WriteByte('}')
+}
+
+// writeList writes a LIST group as an array. The repeated group of elements is unwrapped if it only
+// holds the element.
+func (w *parquetRowWriter) writeList(buf *bytes.Buffer, n *parquetNode) {
+	elements := n.fields[0]
+	buf.WriteByte('[')
+	w.writeRepeated(elements, func(i int) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if elements.node.Leaf() || len(elements.fields) != 1 {
+			w.writeValue(buf, elements)
+		} else if w.isNull(elements.fields[0]) {
+			buf.WriteString("null")
+		} else {
+			w.writeNode(buf, elements.fields[0])
+		}
+	})
+	buf.WriteByte(']')
+}
+
+// writeMap writes a MAP group as an object. Keys which aren't strings are written as their JSON text.
+func (w *parquetRowWriter) writeMap(buf *bytes.Buffer, n *parquetNode) {
+	keyValues := n.fields[0]
+	keyNode, valueNode := keyValues.fields[0], keyValues.fields[1]
+	buf.WriteByte('{')
+	w.writeRepeated(keyValues, func(i int) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		var key bytes.Buffer
+		w.writeNode(&key, keyNode)
+		if key.Len() > 0 && key.Bytes()[0] == '"' {
+			buf.Write(key.Bytes())
+		} else {
+			writeJSONString(buf, key.String())
+		}
+		buf.WriteByte(':')
+		if w.isNull(valueNode) {
+			buf.WriteString("null")
+		} else {
+			w.writeNode(buf, valueNode)
+		}
+	})
+	buf.WriteByte('}')
+}
+
+func (w *parquetRowWriter) writeLeaf(buf *bytes.Buffer, n *parquetNode) {
+	value, _ := w.peek(n)
+	w.skip(n)
+	if value.IsNull() {
+		buf.WriteString("null")
+		return
+	}
+	if n.path == w.timestampColumn {
+		w.timestampValue, w.timestampNode = value.Clone(), n
+	}
+	writeParquetValue(buf, n.node, value)
+}
+
+func isParquetList(n *parquetNode) bool {
+	if len(n.fields) != 1 || !n.fields[0].node.Repeated() {
+		return false
+	}
+	if logicalType := n.node.Type().LogicalType(); logicalType != nil && logicalType.List != nil {
+		return true
+	}
+	convertedType := n.node.Type().ConvertedType()
+	return convertedType != nil && *convertedType == deprecated.List
+}
+
+func isParquetMap(n *parquetNode) bool {
+	if len(n.fields) != 1 || !n.fields[0].node.Repeated() || len(n.fields[0].fields) != 2 {
+		return false
+	}
+	if logicalType := n.node.Type().LogicalType(); logicalType != nil && logicalType.Map != nil {
+		return true
+	}
+	convertedType := n.node.Type().ConvertedType()
+	return convertedType != nil && (*convertedType == deprecated.Map || *convertedType == deprecated.MapKeyValue)
+}
+
+// writeParquetValue writes a value as JSON. Timestamps and dates are written as strings, binary
+// values as strings if they are valid UTF-8, and base64 encoded otherwise.
+func writeParquetValue(buf *bytes.Buffer, node parquet.Node, value parquet.Value) {
+	if timestamp, isTime := parquetValueTime(node, value); isTime {
+		writeJSONString(buf, timestamp.Format(time.RFC3339Nano))
+		return
+	}
+	logicalType := node.Type().LogicalType()
+
+	switch value.Kind() {
+	case parquet.Boolean:
+		buf.WriteString(strconv.FormatBool(value.Boolean()))
+	case parquet.Int32:
+		if logicalType != nil && logicalType.Date != nil {
+			writeJSONString(buf, time.Unix(int64(value.Int32())*24*60*60, 0).UTC().Format(parquetDateLayout))
+			return
+		}
+		buf.WriteString(strconv.FormatInt(int64(value.Int32()), 10))
+	case parquet.Int64:
+		buf.WriteString(strconv.FormatInt(value.Int64(), 10))
+	case parquet.Float:
+		writeJSONFloat(buf, float64(value.Float()), 32)
+	case parquet.Double:
+		writeJSONFloat(buf, value.Double(), 64)
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		if bytesValue := value.ByteArray(); utf8.Valid(bytesValue) {
+			writeJSONString(buf, string(bytesValue))
+		} else {
+			writeJSONString(buf, base64.StdEncoding.EncodeToString(bytesValue))
+		}
+	default:
+		writeJSONString(buf, value.String())
+	}
+}
+
+// parquetValueTime returns the time of timestamp values: INT64 with the timestamp logical or converted
+// type, and INT96.
+func parquetValueTime(node parquet.Node, value parquet.Value) (time.Time, bool) {
+	switch value.Kind() {
+	case parquet.Int96:
+		int96 := value.Int96()
+		nanos := int64(int96[1])<<32 | int64(int96[0])
+		days := int64(int96[2]) - julianDayOfUnixEpoch
+		return time.Unix(days*24*60*60, nanos).UTC(), true
+	case parquet.Int64:
+		if logicalType := node.Type().LogicalType(); logicalType != nil && logicalType.Timestamp != nil {
+			return parquetTimestamp(value.Int64(), logicalType.Timestamp.Unit), true
+		}
+		if convertedType := node.Type().ConvertedType(); convertedType != nil {
+			switch *convertedType {
+			case deprecated.TimestampMillis:
+				return time.UnixMilli(value.Int64()).UTC(), true
+			case deprecated.TimestampMicros:
+				return time.UnixMicro(value.Int64()).UTC(), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func parquetTimestamp(timestamp int64, unit format.TimeUnit) time.Time {
+	switch {
+	case unit.Millis != nil:
+		return time.UnixMilli(timestamp).UTC()
+	case unit.Micros != nil:
+		return time.UnixMicro(timestamp).UTC()
+	default:
+		return time.Unix(0, timestamp).UTC()
+	}
+}
+
+func writeJSONString(buf *bytes.Buffer, value string) {
+	valueBytes, _ := json.Marshal(value)
+	buf.Write(valueBytes)
+}
+
+// writeJSONFloat writes NaN and infinite numbers, which JSON doesn't support, as null.
+func writeJSONFloat(buf *bytes.Buffer, value float64, bitSize int) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		buf.WriteString("null")
+		return
+	}
+	buf.WriteString(strconv.FormatFloat(value, 'g', -1, bitSize))
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarcoal/httpmock"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type testParquetAddress struct {
+	City string  `parquet:"city"`
+	Zip  *string `parquet:"zip,optional"`
+}
+
+type testParquetRecord struct {
+	Time      time.Time            `parquet:"time,timestamp(millisecond)"`
+	Name      *string              `parquet:"name,optional"`
+	Count     int64                `parquet:"count"`
+	Ratio     float64              `parquet:"ratio"`
+	Active    bool                 `parquet:"active"`
+	Day       int32                `parquet:"day,date"`
+	Tags      []string             `parquet:"tags,list"`
+	Ports     []int32              `parquet:"ports"`
+	Labels    map[string]string    `parquet:"labels"`
+	Address   *testParquetAddress  `parquet:"address,optional"`
+	Addresses []testParquetAddress `parquet:"addresses,list"`
+	Raw       []byte               `parquet:"raw"`
+	Created   string               `parquet:"created"`
+}
+
+func writeTestParquetFile(t *testing.T, records []testParquetRecord) []byte {
+	var content bytes.Buffer
+	assert.NoError(t, parquet.Write(&content, records))
+	return content.Bytes()
+}
+
+func buildTestParquetRecords() []testParquetRecord {
+	name, zip := "web", "94105"
+	return []testParquetRecord{
+		{
+			Time:      time.UnixMilli(1685620800123),
+			Name:      &name,
+			Count:     3,
+			Ratio:     0.5,
+			Active:    true,
+			Day:       19509,
+			Tags:      []string{"a", "b"},
+			Ports:     []int32{80, 443},
+			Labels:    map[string]string{"env": "prod"},
+			Address:   &testParquetAddress{City: "San Francisco", Zip: &zip},
+			Addresses: []testParquetAddress{{City: "Paris"}, {City: "Oslo", Zip: &zip}},
+			Raw:       []byte{0xff, 0x00},
+			Created:   "2023-06-01 12:00:00",
+		},
+		{
+			Time:    time.UnixMilli(1685620801000),
+			Created: "not a time",
+		},
+	}
+}
+
+// decodeTestParquetFile decodes the events of a Parquet file held in memory.
+func decodeTestParquetFile(t *testing.T, decoder parquetEventDecoder, content []byte) []decodedEvent {
+	file, err := openParquetFile(bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err)
+
+	var decodedEvents []decodedEvent
+	err = decoder.decodeParquet(file, func(event decodedEvent) error {
+		decodedEvents = append(decodedEvents, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	return decodedEvents
+}
+
+func Test_parquetDecoder_decodeParquet(t *testing.T) {
+	content := writeTestParquetFile(t, buildTestParquetRecords())
+
+	decoder := &parquetDecoder{timestampColumn: "time", timestamps: &timestampExtractor{location: time.UTC}}
+	decodedEvents := decodeTestParquetFile(t, decoder, content)
+	assert.Equal(t, []decodedEvent{
+		{
+			content: `{"time":"2023-06-01T12:00:00.123Z","name":"web","count":3,"ratio":0.5,"active":true,"day":"2023-06-01",` +
+				`"tags":["a","b"],"ports":[80,443],"labels":{"env":"prod"},"address":{"city":"San Francisco","zip":"94105"},` +
+				`"addresses":[{"city":"Paris"},{"city":"Oslo","zip":"94105"}],"raw":"/wA=","created":"2023-06-01 12:00:00"}`,
+			time: time.UnixMilli(1685620800123).UTC(),
+		},
+		{
+			// null fields are left out, empty lists and maps are kept
+			content: `{"time":"2023-06-01T12:00:01Z","count":0,"ratio":0,"active":false,"day":"1970-01-01",` +
+				`"tags":[],"ports":[],"labels":{},"addresses":[],"raw":"","created":"not a time"}`,
+			time: time.UnixMilli(1685620801000).UTC(),
+		},
+	}, decodedEvents)
+
+	for _, event := range decodedEvents {
+		assert.True(t, json.Valid([]byte(event.content)), event.content)
+	}
+}
+
+func Test_parquetDecoder_decodeParquet_parsedTimestampColumn(t *testing.T) {
+	content := writeTestParquetFile(t, buildTestParquetRecords())
+	location, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	decoder := &parquetDecoder{
+		timestampColumn: "created",
+		timestamps:      &timestampExtractor{layout: "2006-01-02 15:04:05", location: location},
+	}
+	decodedEvents := decodeTestParquetFile(t, decoder, content)
+	assert.Len(t, decodedEvents, 2)
+	assert.Equal(t, time.Date(2023, 6, 1, 16, 0, 0, 0, time.UTC), decodedEvents[0].time.UTC())
+	// values which can't be parsed leave the time unknown
+	assert.True(t, decodedEvents[1].time.IsZero())
+}
+
+func Test_parquetRowWriter_write_levels(t *testing.T) {
+	null := parquet.NullValue()
+	a, b := parquet.ByteArrayValue([]byte("a")), parquet.ByteArrayValue([]byte("b"))
+	one, two, three := parquet.Int32Value(1), parquet.Int32Value(2), parquet.Int32Value(3)
+
+	tests := []struct {
+		name             string
+		field            parquet.Node
+		rows             []parquet.Row
+		expectedContents []string
+	}{
+		{
+			name:  "optional",
+			field: parquet.Optional(parquet.Int(32)),
+			rows: []parquet.Row{
+				{one.Level(0, 1, 0)},
+				{null.Level(0, 0, 0)},
+			},
+			expectedContents: []string{`{"f":1}`, `{}`},
+		},
+		{
+			name:  "repeated",
+			field: parquet.Repeated(parquet.Int(32)),
+			rows: []parquet.Row{
+				{one.Level(0, 1, 0), two.Level(1, 1, 0)},
+				{null.Level(0, 0, 0)},
+			},
+			expectedContents: []string{`{"f":[1,2]}`, `{"f":[]}`},
+		},
+		{
+			name:  "optional inside repeated",
+			field: parquet.Repeated(parquet.Group{"v": parquet.Optional(parquet.Int(32))}),
+			rows: []parquet.Row{
+				{one.Level(0, 2, 0), null.Level(1, 1, 0), two.Level(1, 2, 0)},
+				{null.Level(0, 0, 0)},
+			},
+			expectedContents: []string{`{"f":[{"v":1},{},{"v":2}]}`, `{"f":[]}`},
+		},
+		{
+			name:  "null list elements",
+			field: parquet.List(parquet.Optional(parquet.String())),
+			rows: []parquet.Row{
+				{a.Level(0, 2, 0), null.Level(1, 1, 0), b.Level(1, 2, 0)},
+				{null.Level(0, 1, 0)},
+				{null.Level(0, 0, 0)},
+			},
+			expectedContents: []string{`{"f":["a",null,"b"]}`, `{"f":[null]}`, `{"f":[]}`},
+		},
+		{
+			name:  "optional list",
+			field: parquet.Optional(parquet.List(parquet.String())),
+			rows: []parquet.Row{
+				{a.Level(0, 2, 0), b.Level(1, 2, 0)},
+				{null.Level(0, 1, 0)},
+				{null.Level(0, 0, 0)},
+			},
+			expectedContents: []string{`{"f":["a","b"]}`, `{"f":[]}`, `{}`},
+		},
+		{
+			name:  "nested lists",
+			field: parquet.List(parquet.List(parquet.Int(32))),
+			rows: []parquet.Row{
+				{one.Level(0, 2, 0), two.Level(2, 2, 0), null.Level(1, 1, 0), three.Level(1, 2, 0)},
+				{null.Level(0, 1, 0)},
+				{null.Level(0, 0, 0)},
+			},
+			expectedContents: []string{`{"f":[[1,2],[],[3]]}`, `{"f":[[]]}`, `{"f":[]}`},
+		},
+		{
+			name:  "map with null values",
+			field: parquet.Map(parquet.String(), parquet.Optional(parquet.Int(32))),
+			rows: []parquet.Row{
+				{a.Level(0, 1, 0), b.Level(1, 1, 0), one.Level(0, 2, 1), null.Level(1, 1, 1)},
+				{null.Level(0, 0, 0), null.Level(0, 0, 1)},
+			},
+			expectedContents: []string{`{"f":{"a":1,"b":null}}`, `{"f":{}}`},
+		},
+		{
+			name:  "list inside optional group",
+			field: parquet.Optional(parquet.Group{"tags": parquet.List(parquet.String())}),
+			rows: []parquet.Row{
+				{a.Level(0, 2, 0)},
+				{null.Level(0, 1, 0)},
+				{null.Level(0, 0, 0)},
+			},
+			expectedContents: []string{`{"f":{"tags":["a"]}}`, `{"f":{"tags":[]}}`, `{}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var content bytes.Buffer
+			writer := parquet.NewWriter(&content, parquet.NewSchema("row", parquet.Group{"f": tt.field}))
+			_, err := writer.WriteRows(tt.rows)
+			assert.NoError(t, err)
+			assert.NoError(t, writer.Close())
+
+			decoder := &parquetDecoder{timestamps: &timestampExtractor{location: time.UTC}}
+			var contents []string
+			for _, event := range decodeTestParquetFile(t, decoder, content.Bytes()) {
+				contents = append(contents, event.content)
+			}
+			assert.Equal(t, tt.expectedContents, contents)
+		})
+	}
+}
+
+func Test_openParquetFile_invalidFile_error(t *testing.T) {
+	content := []byte("not parquet")
+	_, err := openParquetFile(bytes.NewReader(content), int64(len(content)))
+	assert.ErrorContains(t, err, "invalid parquet file")
+}
+
+func Test_parquetDecoder_decode_streamedContent_error(t *testing.T) {
+	content := writeTestParquetFile(t, buildTestParquetRecords())
+	err := (&parquetDecoder{}).decode(bytes.NewReader(content), func(event decodedEvent) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, errStreamedParquetContent)
+}
+
+func Test_recordsProcessor_process_parquet(t *testing.T) {
+	const (
+		parquetKey    = "ext/source/region=us-east-1/accountId=123456789012/eventDay=20230601/file.gz.parquet"
+		flowLogKey    = "AWSLogs/123456789012/vpcflowlogs/us-west-2/2023/06/01/file.log.parquet"
+		rawParquetKey = "exports/data"
+		// flow log keys don't always end with .parquet, the content is Parquet
+		renamedFlowLogKey = "AWSLogs/123456789012/vpcflowlogs/us-west-2/2023/06/01/renamed"
+		emptyParquetKey   = "exports/empty"
+	)
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var hecEvents []hecEvent
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost"+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		decoder := json.NewDecoder(req.Body)
+		for decoder.More() {
+			var event hecEvent
+			assert.NoError(t, decoder.Decode(&event))
+			hecEvents = append(hecEvents, event)
+		}
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	srcAddr := "172.31.16.139"
+	var flowLogContent bytes.Buffer
+	assert.NoError(t, parquet.Write(&flowLogContent, []testVPCFlowLogRecord{
+		{Version: 5, AccountID: "123456789012", SrcAddr: &srcAddr, Start: 1685620800},
+	}))
+	s3Client := &objectsTestS3Client{
+		objects: map[string]string{
+			parquetKey:        string(writeTestParquetFile(t, buildTestParquetRecords())),
+			flowLogKey:        flowLogContent.String(),
+			rawParquetKey:     string(writeTestParquetFile(t, buildTestParquetRecords()[1:])),
+			renamedFlowLogKey: flowLogContent.String(),
+			emptyParquetKey:   "",
+		},
+	}
+	cfg := buildTestConfig(t)
+	cfg.ParquetTimestampColumn = "time"
+	cfg.RoutingRules = []routingRule{{keyPrefix: "exports/", decoder: parquetDecoderName}}
+	h := newHandler(cfg, s3Client, &http.Client{}, &mapTestSecretsManagerClient{})
+	h.processor.concurrency = 1
+
+	errs := h.processor.process(context.Background(), []events.S3EventRecord{
+		buildTestRecord(parquetKey),
+		buildTestRecord(flowLogKey),
+		buildTestRecord(rawParquetKey),
+		buildTestRecord(renamedFlowLogKey),
+		buildTestRecord(emptyParquetKey),
+	})
+	assert.Equal(t, []error{nil, nil, nil, nil, nil}, errs)
+
+	assert.Len(t, hecEvents, 5)
+	assert.Equal(t, 1685620800.123, hecEvents[0].Time)
+	assert.Equal(t, 1685620801.0, hecEvents[1].Time)
+	assert.Equal(t, defaultSourcetype, hecEvents[0].Sourcetype)
+	assert.Equal(t, "5 123456789012 172.31.16.139 1685620800 -", hecEvents[2].Event)
+	assert.Equal(t, vpcFlowLogSourcetype, hecEvents[2].Sourcetype)
+	assert.Equal(t, 1685620801.0, hecEvents[3].Time)
+	assert.Equal(t, hecEvents[2].Event, hecEvents[4].Event)
+
+	// parquet objects are read with ranged requests. Only the renamed flow log is also fetched as a whole,
+	// to find it is Parquet, which also gives its size instead of requesting its first byte
+	assert.NotEmpty(t, s3Client.fetchedRanges)
+	assert.Equal(t, len(s3Client.fetchedKeys)-1, len(s3Client.fetchedRanges))
+	var sizeRequests int
+	for _, fetchedRange := range s3Client.fetchedRanges {
+		if fetchedRange == "bytes=0-0" {
+			sizeRequests++
+		}
+	}
+	assert.Equal(t, 4, sizeRequests)
+}
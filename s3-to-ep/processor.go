@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	maxConcurrencyEnvKey  = "MAX_CONCURRENCY"
+	defaultMaxConcurrency = 4
+)
+
+// recordsProcessor sends S3 records to EP with a bounded pool of workers sharing the same clients.
+// Each record is handled by a single worker with its own batcher so events of an object are sent in order.
+type recordsProcessor struct {
+	cfg         *Config
+	s3Client    S3Client
+	httpClient  *http.Client
+	breaker     *lineBreaker
+	concurrency int
+	// secrets is set if the configuration has values stored in Secrets Manager
+	secrets *secretsResolver
+}
+
+func newRecordsProcessor(cfg *Config, s3Client S3Client, httpClient *http.Client) *recordsProcessor {
+	return &recordsProcessor{
+		cfg:         cfg,
+		s3Client:    s3Client,
+		httpClient:  httpClient,
+		breaker:     buildLineBreaker(cfg),
+		concurrency: cfg.MaxConcurrency,
+	}
+}
+
+// connection returns the configuration and http client to send the records of the invocation with.
+func (p *recordsProcessor) connection(ctx context.Context) (*Config, *http.Client, error) {
+	if p.secrets == nil {
+		return p.cfg, p.httpClient, nil
+	}
+	return p.secrets.resolve(ctx)
+}
+
+// process handles all records even if some of them fail. It returns the error of each record,
+// nil if the record was sent successfully. Duplicated records are only sent once.
+// Records which can't be started before the context is done fail with the context error.
+func (p *recordsProcessor) process(ctx context.Context, records []events.S3EventRecord) []error {
+	errs := make([]error, len(records))
+	cfg, httpClient, err := p.connection(ctx)
+	if err != nil {
+		log.Printf("error resolving secrets: %s", err)
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	recordIndexes := make(map[string]int, len(records))
+	duplicates := make(map[int]int)
+	var uniqueIndexes []int
+	for i, record := range records {
+		recordID := getRecordID(record)
+		if firstIndex, found := recordIndexes[recordID]; found {
+			duplicates[i] = firstIndex
+			continue
+		}
+		recordIndexes[recordID] = i
+		uniqueIndexes = append(uniqueIndexes, i)
+	}
+
+	workerCount := p.concurrency
+	if len(uniqueIndexes) < workerCount {
+		workerCount = len(uniqueIndexes)
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workerCount; w++ {
+		wg.Add(1)
+		go func(batcher *hecBatcher) {
+			defer wg.Done()
+			p.work(ctx, cfg, batcher, records, indexes, errs)
+		}(buildHecBatcher(cfg, httpClient))
+	}
+	for _, i := range uniqueIndexes {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, firstIndex := range duplicates {
+		errs[i] = errs[firstIndex]
+	}
+	return errs
+}
+
+// work handles the records received from indexes until it is closed. Each record error is set in errs
+// at the index of the record, which is only accessed by this worker.
+func (p *recordsProcessor) work(ctx context.Context, cfg *Config, batcher *hecBatcher, records []events.S3EventRecord, indexes <-chan int, errs []error) {
+	var handledIndexes []int
+	for i := range indexes {
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		handledIndexes = append(handledIndexes, i)
+		if err := p.handleS3Record(ctx, cfg, batcher, records[i]); err != nil {
+			// drop events left from the failed record so they aren't sent as it will be retried
+			batcher.discard(getRecordID(records[i]))
+			errs[i] = err
+		}
+	}
+
+	if err := batcher.flush(ctx); err != nil {
+		log.Printf("error sending last batch: %s", err)
+	}
+
+	// records can also fail after being handled when their batch is sent
+	for _, i := range handledIndexes {
+		if errs[i] == nil {
+			errs[i] = batcher.failure(getRecordID(records[i]))
+		}
+	}
+}
+
+func (p *recordsProcessor) handleS3Record(ctx context.Context, cfg *Config, batcher *hecBatcher, record events.S3EventRecord) error {
+	// ignore folders
+	if strings.HasSuffix(record.S3.Object.Key, folderSuffix) {
+		return nil
+	}
+
+	cfg = cfg.route(record)
+	if cfg.Decoder == cloudTrailDecoderName && isCloudTrailDigestKey(getObjectKey(record)) {
+		log.Printf("skipping cloudtrail digest file %s", getObjectKey(record))
+		return nil
+	}
+
+	decoder := buildEventDecoder(cfg, p.breaker)
+	_, isParquetDecoder := decoder.(parquetEventDecoder)
+	if isParquetDecoder && isParquetObject(cfg, getObjectKey(record)) {
+		object, err := openS3Object(ctx, p.s3Client, record)
+		if errors.Is(err, errEmptyS3Object) {
+			log.Printf("skipping empty parquet object %s", getObjectKey(record))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return p.handleParquetObject(ctx, cfg, batcher, record, decoder, object)
+	}
+
+	s3ContentReader, err := fetchS3Content(ctx, p.s3Client, record)
+	if err != nil {
+		log.Printf("error fetching s3 object: %s", err)
+		return err
+	}
+	// Parquet objects without a .parquet key are found from their content and read again with ranged requests
+	if isParquetDecoder && s3ContentReader.parquetObject != nil {
+		_ = s3ContentReader.Close()
+		return p.handleParquetObject(ctx, cfg, batcher, record, decoder, s3ContentReader.parquetObject)
+	}
+	defer s3ContentReader.Close()
+
+	payloadBuilder := buildPayloadBuilder(cfg, record, decoder, s3ContentReader.lastModified)
+
+	err = payloadBuilder.build(s3ContentReader, func(payload []byte) error {
+		return batcher.add(ctx, getRecordID(record), payloadBuilder.epUrl, payload)
+	})
+	if err != nil {
+		log.Printf("error sending s3 object content: %s", err)
+		return err
+	}
+	return nil
+}
+
+// handleParquetObject reads row groups of the record object with ranged requests instead of downloading it.
+func (p *recordsProcessor) handleParquetObject(ctx context.Context, cfg *Config, batcher *hecBatcher, record events.S3EventRecord, decoder eventDecoder, object *s3ObjectReaderAt) error {
+	file, err := openParquetFile(object, object.size)
+	if err != nil {
+		log.Printf("error reading parquet object %s: %s", getObjectKey(record), err)
+		return err
+	}
+
+	payloadBuilder := buildPayloadBuilder(cfg, record, decoder, object.lastModified)
+	err = decoder.(parquetEventDecoder).decodeParquet(file, payloadBuilder.emitter(func(payload []byte) error {
+		return batcher.add(ctx, getRecordID(record), payloadBuilder.epUrl, payload)
+	}))
+	if err != nil {
+		log.Printf("error sending s3 object content: %s", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildTestRecord(key string) events.S3EventRecord {
+	return events.S3EventRecord{
+		S3: events.S3Entity{
+			Bucket: events.S3Bucket{Name: "test-bucket"},
+			Object: events.S3Object{Key: key},
+		},
+	}
+}
+
+func Test_recordsProcessor_handleS3Record_folderEventsAreIgnored(t *testing.T) {
+	record := events.S3EventRecord{
+		S3: events.S3Entity{
+			Bucket: events.S3Bucket{
+				Name: "test-bucket",
+			},
+			Object: events.S3Object{
+				Key: "test-key/",
+			},
+		},
+	}
+	s3Client := &staticTestS3Client{}
+	processor := newRecordsProcessor(buildTestConfig(t), s3Client, &http.Client{})
+
+	err := processor.handleS3Record(context.Background(), processor.cfg, nil, record)
+	assert.NoError(t, err)
+	assert.Nil(t, s3Client.params)
+}
+
+func Test_recordsProcessor_handleS3Record_hecIngestionSuccess(t *testing.T) {
+	const (
+		s3Content = "test-content"
+		testURL   = "http://localhost/services/collector"
+	)
+	assert.NoError(t, os.Setenv(epHostEnvKey, testURL))
+	assert.NoError(t, os.Setenv(retryBaseDelayEnvKey, "1ms"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+		_ = os.Unsetenv(retryBaseDelayEnvKey)
+	})
+
+	record := events.S3EventRecord{
+		S3: events.S3Entity{
+			Bucket: events.S3Bucket{
+				Name: "test-bucket",
+			},
+			Object: events.S3Object{
+				Key: "test-key",
+			},
+		},
+	}
+
+	tests := []struct {
+		name               string
+		httpResponseStatus int
+		expectedErr        bool
+	}{
+		{
+			name:               "hec event ingestion was successful",
+			httpResponseStatus: 200,
+		},
+		{
+			name:               "hec event ingestion ran into server error",
+			httpResponseStatus: 500,
+			expectedErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+
+			httpmock.RegisterResponder(http.MethodPost, testURL, func(_ *http.Request) (*http.Response, error) {
+				return httpmock.NewJsonResponse(tt.httpResponseStatus, map[string]interface{}{
+					"mockResponse": "",
+				})
+			})
+
+			s3Client := &staticTestS3Client{
+				output: &s3.GetObjectOutput{
+					Body: io.NopCloser(strings.NewReader(s3Content)),
+				},
+			}
+			processor := newRecordsProcessor(buildTestConfig(t), s3Client, &http.Client{})
+			batcher := buildHecBatcher(buildTestConfig(t), &http.Client{})
+
+			err := processor.handleS3Record(context.Background(), processor.cfg, batcher, record)
+			assert.NoError(t, err)
+
+			err = batcher.flush(context.Background())
+			if tt.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_recordsProcessor_process_failedRecordsIsolated(t *testing.T) {
+	const testURL = "http://localhost"
+	assert.NoError(t, os.Setenv(epHostEnvKey, testURL))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+	})
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var bodies []string
+	httpmock.RegisterResponder(http.MethodPost, testURL+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	records := []events.S3EventRecord{
+		buildTestRecord("key-1"),
+		buildTestRecord("missing-key"),
+		buildTestRecord("key-2"),
+		buildTestRecord("key-1"),
+	}
+	s3Client := &objectsTestS3Client{
+		objects: map[string]string{
+			"key-1": "content-1",
+			"key-2": "content-2",
+		},
+	}
+	assert.NoError(t, os.Setenv(maxConcurrencyEnvKey, "1"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(maxConcurrencyEnvKey)
+	})
+	processor := newRecordsProcessor(buildTestConfig(t), s3Client, &http.Client{})
+
+	errs := processor.process(context.Background(), records)
+	assert.Len(t, errs, len(records))
+	assert.NoError(t, errs[0])
+	assert.Error(t, errs[1])
+	assert.NoError(t, errs[2])
+	assert.NoError(t, errs[3])
+	assert.Equal(t, []string{"key-1", "missing-key", "key-2"}, s3Client.fetchedKeys)
+	assert.Len(t, bodies, 1)
+
+	err := buildRecordsError(records, errs)
+	assert.Error(t, err)
+	assert.Equal(t, "failed to process 1 of 4 records:\ns3://test-bucket/missing-key: no such key", err.Error())
+}
+
+// barrierTestS3Client tracks the max number of concurrent GetObject calls. Calls are blocked until
+// barrierSize calls are in flight at once, then all calls are released.
+type barrierTestS3Client struct {
+	barrierSize int
+	released    chan struct{}
+	releaseOnce sync.Once
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (c *barrierTestS3Client) GetObject(ctx context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	if c.inFlight == c.barrierSize {
+		c.releaseOnce.Do(func() {
+			close(c.released)
+		})
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.inFlight--
+		c.mu.Unlock()
+	}()
+	select {
+	case <-c.released:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader("test-content")),
+	}, nil
+}
+
+func Test_recordsProcessor_process_boundedConcurrency(t *testing.T) {
+	const testURL = "http://localhost"
+	assert.NoError(t, os.Setenv(epHostEnvKey, testURL))
+	assert.NoError(t, os.Setenv(maxConcurrencyEnvKey, "3"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+		_ = os.Unsetenv(maxConcurrencyEnvKey)
+	})
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder(http.MethodPost, testURL+formattedEndpointSuffix, httpmock.NewStringResponder(http.StatusOK, ""))
+
+	var records []events.S3EventRecord
+	for i := 0; i < 10; i++ {
+		records = append(records, buildTestRecord(fmt.Sprintf("key-%d", i)))
+	}
+	s3Client := &barrierTestS3Client{barrierSize: 3, released: make(chan struct{})}
+	processor := newRecordsProcessor(buildTestConfig(t), s3Client, &http.Client{})
+
+	// records fail if fewer than 3 workers ever run at once
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errs := processor.process(ctx, records)
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.LessOrEqual(t, s3Client.maxInFlight, 3)
+	// each worker sends its own batch
+	assert.Equal(t, 3, httpmock.GetTotalCallCount())
+}
+
+func Test_recordsProcessor_process_contextDone_recordsFailed(t *testing.T) {
+	records := []events.S3EventRecord{
+		buildTestRecord("key-1"),
+		buildTestRecord("key-2"),
+	}
+	s3Client := &objectsTestS3Client{}
+	processor := newRecordsProcessor(buildTestConfig(t), s3Client, &http.Client{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs := processor.process(ctx, records)
+	for _, err := range errs {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+	assert.Empty(t, s3Client.fetchedKeys)
+}
+
+// lingeringTestReader returns its content then blocks until released, like a slow S3 read.
+type lingeringTestReader struct {
+	content  string
+	released <-chan struct{}
+}
+
+func (r *lingeringTestReader) Read(p []byte) (int, error) {
+	if r.content != "" {
+		n := copy(p, r.content)
+		r.content = r.content[n:]
+		return n, nil
+	}
+	select {
+	case <-r.released:
+		return 0, io.EOF
+	case <-time.After(5 * time.Second):
+		return 0, errors.New("batch wasn't sent while the object was being read")
+	}
+}
+
+func Test_recordsProcessor_process_lingeringBatchSentWhileReading(t *testing.T) {
+	const testURL = "http://localhost"
+	assert.NoError(t, os.Setenv(epHostEnvKey, testURL))
+	assert.NoError(t, os.Setenv(batchMaxLingerEnvKey, "10ms"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+		_ = os.Unsetenv(batchMaxLingerEnvKey)
+	})
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	released := make(chan struct{})
+	var releaseOnce sync.Once
+	var bodies []string
+	httpmock.RegisterResponder(http.MethodPost, testURL+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+		releaseOnce.Do(func() {
+			close(released)
+		})
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	s3Client := &staticTestS3Client{
+		output: &s3.GetObjectOutput{
+			Body: io.NopCloser(&lingeringTestReader{content: "event-1\nevent-2", released: released}),
+		},
+	}
+	processor := newRecordsProcessor(buildTestConfig(t), s3Client, &http.Client{})
+
+	errs := processor.process(context.Background(), []events.S3EventRecord{buildTestRecord("key-1")})
+	assert.Equal(t, []error{nil}, errs)
+	// event-1 is sent by the linger timer, event-2 once the object is read
+	assert.Len(t, bodies, 2)
+	assert.Contains(t, bodies[0], "event-1")
+	assert.Contains(t, bodies[1], "event-2")
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	retryMaxAttemptsEnvKey = "RETRY_MAX_ATTEMPTS"
+	retryBaseDelayEnvKey   = "RETRY_BASE_DELAY"
+	retryMaxDelayEnvKey    = "RETRY_MAX_DELAY"
+
+	defaultRetryMaxAttempts = 5
+	defaultRetryBaseDelay   = 200 * time.Millisecond
+	defaultRetryMaxDelay    = 30 * time.Second
+
+	retryAfterHeader = "Retry-After"
+)
+
+var retryableStatusCodes = map[int]bool{
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// hecResponseError is returned when EP responds with an unsuccessful status code.
+type hecResponseError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *hecResponseError) Error() string {
+	return fmt.Sprintf("http response was not successful. Status code: %d, Response Body: %s", e.StatusCode, e.Body)
+}
+
+// requestBodyError is returned when the body of a request can't be read for an attempt.
+type requestBodyError struct {
+	err error
+}
+
+func (e *requestBodyError) Error() string {
+	return fmt.Sprintf("error reading http request body: %s", e.err)
+}
+
+func (e *requestBodyError) Unwrap() error {
+	return e.err
+}
+
+// isRetryableError is false for errors which would fail the same way on every attempt, such as
+// non retryable status codes, certificates which can't be verified or request bodies which can't be read.
+func isRetryableError(err error) bool {
+	var responseErr *hecResponseError
+	if errors.As(err, &responseErr) {
+		return retryableStatusCodes[responseErr.StatusCode]
+	}
+
+	var bodyErr *requestBodyError
+	var verificationErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCertErr x509.CertificateInvalidError
+	return !errors.As(err, &bodyErr) &&
+		!errors.As(err, &verificationErr) &&
+		!errors.As(err, &unknownAuthorityErr) &&
+		!errors.As(err, &hostnameErr) &&
+		!errors.As(err, &invalidCertErr)
+}
+
+// validateRequestURL checks the url can be requested at all, as the http client fails the same way on every attempt otherwise.
+func validateRequestURL(reqURL *url.URL) error {
+	if reqURL == nil || (reqURL.Scheme != "http" && reqURL.Scheme != "https") || reqURL.Host == "" {
+		return errors.New("http request url must be an absolute http or https url")
+	}
+	return nil
+}
+
+// retryPolicy retries failed http calls to EP with exponential backoff and full jitter.
+// Retries stop when maxAttempts is reached or when the next attempt can't happen before the context deadline.
+// Errors which can't succeed on a later attempt aren't retried.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+func buildRetryPolicy(cfg *Config) *retryPolicy {
+	return &retryPolicy{
+		maxAttempts: cfg.RetryMaxAttempts,
+		baseDelay:   cfg.RetryBaseDelay,
+		maxDelay:    cfg.RetryMaxDelay,
+	}
+}
+
+func (p *retryPolicy) do(ctx context.Context, httpClient *http.Client, req *http.Request) error {
+	if err := validateRequestURL(req.URL); err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := p.attempt(ctx, httpClient, req)
+		if err == nil {
+			return nil
+		}
+
+		if !isRetryableError(err) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if attempt >= p.maxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := p.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return fmt.Errorf("not enough time left before deadline to retry: %w", err)
+		}
+
+		log.Printf("http call to EP failed. Retrying in %s. Attempt: %d, Error: %s", delay, attempt, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt makes a single http call. It returns the delay requested by EP through Retry-After if any.
+func (p *retryPolicy) attempt(ctx context.Context, httpClient *http.Client, req *http.Request) (time.Duration, error) {
+	attemptReq := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return 0, &requestBodyError{err: err}
+		}
+		attemptReq.Body = body
+	}
+
+	res, err := httpClient.Do(attemptReq)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactURL(urlErr.URL)
+		}
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	resBodyBytes, _ := io.ReadAll(res.Body)
+	if res.StatusCode >= 400 && res.StatusCode < 600 {
+		return parseRetryAfter(res.Header.Get(retryAfterHeader)), &hecResponseError{
+			StatusCode: res.StatusCode,
+			Body:       string(resBodyBytes),
+		}
+	}
+	return 0, nil
+}
+
+func (p *retryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.maxDelay
+	if shift := attempt - 1; shift < 32 {
+		if exp := p.baseDelay << shift; exp > 0 && exp < ceiling {
+			ceiling = exp
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// parseRetryAfter supports both delay seconds and http date formats of the Retry-After header.
+func parseRetryAfter(retryAfter string) time.Duration {
+	if retryAfter == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRetryURL = "http://localhost/services/collector"
+
+func buildTestRetryPolicy(t *testing.T) *retryPolicy {
+	assert.NoError(t, os.Setenv(retryBaseDelayEnvKey, "1ms"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(retryBaseDelayEnvKey)
+	})
+
+	policy := buildRetryPolicy(buildTestConfig(t))
+	return policy
+}
+
+func Test_buildRetryPolicy_noEnvSet_useDefault(t *testing.T) {
+	policy := buildRetryPolicy(buildTestConfig(t))
+	assert.Equal(t, defaultRetryMaxAttempts, policy.maxAttempts)
+	assert.Equal(t, defaultRetryBaseDelay, policy.baseDelay)
+	assert.Equal(t, defaultRetryMaxDelay, policy.maxDelay)
+}
+
+func Test_retryPolicy_do(t *testing.T) {
+	tests := []struct {
+		name                  string
+		statusCodes           []int
+		expectedCalls         int
+		expectedErr           bool
+		expectedErrStatusCode int
+	}{
+		{
+			name:          "success on first attempt",
+			statusCodes:   []int{http.StatusOK},
+			expectedCalls: 1,
+		},
+		{
+			name:          "retryable errors then success",
+			statusCodes:   []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK},
+			expectedCalls: 3,
+		},
+		{
+			name:                  "non retryable error fails fast",
+			statusCodes:           []int{http.StatusUnauthorized},
+			expectedCalls:         1,
+			expectedErr:           true,
+			expectedErrStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:                  "retryable error exhausts attempts",
+			statusCodes:           []int{http.StatusInternalServerError},
+			expectedCalls:         defaultRetryMaxAttempts,
+			expectedErr:           true,
+			expectedErrStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+
+			calls := 0
+			httpmock.RegisterResponder(http.MethodPost, testRetryURL, func(req *http.Request) (*http.Response, error) {
+				statusCode := tt.statusCodes[len(tt.statusCodes)-1]
+				if calls < len(tt.statusCodes) {
+					statusCode = tt.statusCodes[calls]
+				}
+				calls++
+				return httpmock.NewStringResponse(statusCode, "test-response"), nil
+			})
+
+			req, err := http.NewRequest(http.MethodPost, testRetryURL, strings.NewReader("test-body"))
+			assert.NoError(t, err)
+
+			err = buildTestRetryPolicy(t).do(context.Background(), &http.Client{}, req)
+			assert.Equal(t, tt.expectedCalls, calls)
+			if !tt.expectedErr {
+				assert.NoError(t, err)
+				return
+			}
+
+			var responseErr *hecResponseError
+			assert.True(t, errors.As(err, &responseErr))
+			assert.Equal(t, tt.expectedErrStatusCode, responseErr.StatusCode)
+			assert.Equal(t, "test-response", responseErr.Body)
+		})
+	}
+}
+
+func Test_retryPolicy_do_networkErrorRetried(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	calls := 0
+	httpmock.RegisterResponder(http.MethodPost, testRetryURL, func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("connection reset by peer")
+		}
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	req, err := http.NewRequest(http.MethodPost, testRetryURL, strings.NewReader("test-body"))
+	assert.NoError(t, err)
+
+	err = buildTestRetryPolicy(t).do(context.Background(), &http.Client{}, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func Test_retryPolicy_do_permanentErrorFailsFast(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		responseErr   error
+		getBodyErr    error
+		expectedCalls int
+	}{
+		{
+			name:          "certificate verification error",
+			url:           testRetryURL,
+			responseErr:   &tls.CertificateVerificationError{Err: errors.New("certificate has expired")},
+			expectedCalls: 1,
+		},
+		{
+			name:          "unknown certificate authority",
+			url:           testRetryURL,
+			responseErr:   x509.UnknownAuthorityError{},
+			expectedCalls: 1,
+		},
+		{
+			name:          "certificate not valid for host",
+			url:           testRetryURL,
+			responseErr:   x509.HostnameError{Certificate: &x509.Certificate{}, Host: "localhost"},
+			expectedCalls: 1,
+		},
+		{
+			name:       "request body can't be read",
+			url:        testRetryURL,
+			getBodyErr: errors.New("body already closed"),
+		},
+		{
+			name: "unsupported url scheme",
+			url:  "localhost:8088/services/collector",
+		},
+		{
+			name: "url without host",
+			url:  "http:///services/collector",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+			httpmock.RegisterNoResponder(func(req *http.Request) (*http.Response, error) {
+				if tt.responseErr != nil {
+					return nil, tt.responseErr
+				}
+				return httpmock.NewStringResponse(http.StatusOK, ""), nil
+			})
+
+			req, err := http.NewRequest(http.MethodPost, tt.url, strings.NewReader("test-body"))
+			assert.NoError(t, err)
+			if tt.getBodyErr != nil {
+				req.GetBody = func() (io.ReadCloser, error) {
+					return nil, tt.getBodyErr
+				}
+			}
+
+			err = buildTestRetryPolicy(t).do(context.Background(), &http.Client{}, req)
+			assert.Error(t, err)
+			assert.NotContains(t, err.Error(), "giving up")
+			assert.Equal(t, tt.expectedCalls, httpmock.GetTotalCallCount())
+		})
+	}
+}
+
+func Test_retryPolicy_do_retryAfterExceedsDeadline_error(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	calls := 0
+	httpmock.RegisterResponder(http.MethodPost, testRetryURL, func(req *http.Request) (*http.Response, error) {
+		calls++
+		res := httpmock.NewStringResponse(http.StatusServiceUnavailable, "")
+		res.Header.Set(retryAfterHeader, "120")
+		return res, nil
+	})
+
+	req, err := http.NewRequest(http.MethodPost, testRetryURL, strings.NewReader("test-body"))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = buildTestRetryPolicy(t).do(ctx, &http.Client{}, req)
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_retryPolicy_backoff_boundedByMaxDelay(t *testing.T) {
+	policy := &retryPolicy{
+		maxAttempts: 100,
+		baseDelay:   time.Second,
+		maxDelay:    5 * time.Second,
+	}
+	for attempt := 1; attempt < 100; attempt++ {
+		delay := policy.backoff(attempt)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, policy.maxDelay)
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+
+	delay := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.Greater(t, delay, 59*time.Minute)
+	assert.LessOrEqual(t, delay, time.Hour)
+}
+
+func Test_retryPolicy_do_networkErrorTokenRedacted(t *testing.T) {
+	const urlWithToken = testRetryURL + "?token=secret"
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder(http.MethodPost, urlWithToken, httpmock.NewErrorResponder(errors.New("connection refused")))
+
+	req, err := http.NewRequest(http.MethodPost, urlWithToken, strings.NewReader("test-body"))
+	assert.NoError(t, err)
+
+	policy := buildTestRetryPolicy(t)
+	policy.maxAttempts = 1
+	err = policy.do(context.Background(), &http.Client{}, req)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"gopkg.in/yaml.v3"
+)
+
+const routingRulesEnvKey = "ROUTING_RULES"
+
+// routingRuleSpec is a routing rule as written in ROUTING_RULES.
+type routingRuleSpec struct {
+	Bucket     string `yaml:"bucket"`
+	KeyPrefix  string `yaml:"key_prefix"`
+	KeyGlob    string `yaml:"key_glob"`
+	KeyRegex   string `yaml:"key_regex"`
+	Sourcetype string `yaml:"sourcetype"`
+	Index      string `yaml:"index"`
+	Source     string `yaml:"source"`
+	Host       string `yaml:"host"`
+	EPHost     string `yaml:"ep_host"`
+	Decoder    string `yaml:"decoder"`
+}
+
+// routingRule overrides the event metadata and EP host of the objects it matches.
+// An object matches if it matches all the conditions set on the rule.
+type routingRule struct {
+	bucket    string
+	keyPrefix string
+	keyGlob   string
+	keyRegex  *regexp.Regexp
+
+	sourcetype string
+	index      string
+	source     string
+	host       string
+	epHost     *url.URL
+	decoder    string
+}
+
+// parseRoutingRules parses a YAML or JSON list of routing rules. Rules are kept in order
+// as the first matching rule is applied. Rule templates can use the variables of keyPattern
+// and the named groups of their key_regex.
+func parseRoutingRules(rulesStr string, keyPattern *regexp.Regexp) ([]routingRule, error) {
+	if rulesStr == "" {
+		return nil, nil
+	}
+
+	var specs []routingRuleSpec
+	decoder := yaml.NewDecoder(strings.NewReader(rulesStr))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&specs); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s is not a valid YAML or JSON list of rules: %w", routingRulesEnvKey, err)
+	}
+
+	var errs []error
+	rules := make([]routingRule, 0, len(specs))
+	for i, spec := range specs {
+		rule, err := parseRoutingRule(spec, keyPattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s rule %d: %w", routingRulesEnvKey, i+1, err))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func parseRoutingRule(spec routingRuleSpec, keyPattern *regexp.Regexp) (routingRule, error) {
+	rule := routingRule{
+		bucket:     spec.Bucket,
+		keyPrefix:  spec.KeyPrefix,
+		keyGlob:    spec.KeyGlob,
+		sourcetype: spec.Sourcetype,
+		index:      spec.Index,
+		source:     spec.Source,
+		host:       spec.Host,
+	}
+	if spec.Bucket == "" && spec.KeyPrefix == "" && spec.KeyGlob == "" && spec.KeyRegex == "" {
+		return rule, errors.New("at least one of bucket, key_prefix, key_glob and key_regex must be set")
+	}
+	if spec.Sourcetype == "" && spec.Index == "" && spec.Source == "" && spec.Host == "" && spec.EPHost == "" && spec.Decoder == "" {
+		return rule, errors.New("at least one of sourcetype, index, source, host, ep_host and decoder must be set")
+	}
+
+	var err error
+	if spec.Decoder != "" {
+		if rule.decoder, err = parseDecoderName("decoder", spec.Decoder); err != nil {
+			return rule, err
+		}
+	}
+	if spec.KeyGlob != "" {
+		if _, err = path.Match(spec.KeyGlob, ""); err != nil {
+			return rule, fmt.Errorf("key_glob %q is not a valid glob: %w", spec.KeyGlob, err)
+		}
+	}
+	if spec.KeyRegex != "" {
+		if rule.keyRegex, err = regexp.Compile(spec.KeyRegex); err != nil {
+			return rule, fmt.Errorf("key_regex %q is not a valid regex: %w", spec.KeyRegex, err)
+		}
+	}
+	for _, template := range [][2]string{{"sourcetype", spec.Sourcetype}, {"source", spec.Source}, {"host", spec.Host}} {
+		if err = validateKeyTemplate(template[0], template[1], keyPattern, rule.keyRegex); err != nil {
+			return rule, err
+		}
+	}
+	if spec.EPHost != "" {
+		if rule.epHost, err = parseEPHost("ep_host", spec.EPHost); err != nil {
+			return rule, err
+		}
+	}
+	return rule, nil
+}
+
+func (r *routingRule) matches(bucket, key string) bool {
+	if r.bucket != "" && r.bucket != bucket {
+		return false
+	}
+	if r.keyPrefix != "" && !strings.HasPrefix(key, r.keyPrefix) {
+		return false
+	}
+	if r.keyGlob != "" {
+		if matched, _ := path.Match(r.keyGlob, key); !matched {
+			return false
+		}
+	}
+	return r.keyRegex == nil || r.keyRegex.MatchString(key)
+}
+
+// route returns the configuration to send the record with: a copy of cfg with the overrides of
+// the first routing rule matching the record object and the decoder of the object.
+// Decoders of AWS logs replace the sourcetype unless it was set explicitly.
+func (cfg *Config) route(record events.S3EventRecord) *Config {
+	bucket, key := record.S3.Bucket.Name, getObjectKey(record)
+	routedCfg := *cfg
+	var matchedRule *routingRule
+	for i := range cfg.RoutingRules {
+		if cfg.RoutingRules[i].matches(bucket, key) {
+			matchedRule = &cfg.RoutingRules[i]
+			break
+		}
+	}
+
+	if matchedRule != nil {
+		routedCfg.applyRule(matchedRule)
+	}
+	if routedCfg.Decoder == autoDecoderName {
+		routedCfg.Decoder = detectDecoderName(key)
+	}
+	if sourcetype, found := decoderSourcetypes[routedCfg.Decoder]; found && !routedCfg.SourcetypeSet {
+		routedCfg.Sourcetype = sourcetype
+	}
+	return &routedCfg
+}
+
+func (cfg *Config) applyRule(rule *routingRule) {
+	if rule.sourcetype != "" {
+		cfg.Sourcetype = rule.sourcetype
+		cfg.SourcetypeSet = true
+	}
+	if rule.index != "" {
+		cfg.Index = rule.index
+	}
+	if rule.source != "" {
+		cfg.Source = rule.source
+	}
+	if rule.host != "" {
+		cfg.Host = rule.host
+	}
+	if rule.epHost != nil {
+		cfg.EPHost = rule.epHost
+	}
+	if rule.decoder != "" {
+		cfg.Decoder = rule.decoder
+	}
+	cfg.RuleKeyRegex = rule.keyRegex
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRoutingRules = `
+- bucket: logs-bucket
+  key_prefix: AWSLogs/123456789012/CloudTrail/
+  sourcetype: aws:cloudtrail
+  index: cloudtrail
+- key_glob: "*/alb/*.log.gz"
+  sourcetype: aws:elb:accesslogs
+- key_regex: '^app/(web|api)/'
+  index: app
+  source: app-logs
+  host: app-host
+  ep_host: http://app-ep:8088
+`
+
+func Test_parseRoutingRules_invalidRules_error(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       string
+		expectedErr string
+	}{
+		{
+			name:        "not a list",
+			rules:       `{"key_prefix": "logs/"}`,
+			expectedErr: "ROUTING_RULES is not a valid YAML or JSON list of rules",
+		},
+		{
+			name:        "unknown key",
+			rules:       `[{"prefix": "logs/", "index": "logs"}]`,
+			expectedErr: "ROUTING_RULES is not a valid YAML or JSON list of rules",
+		},
+		{
+			name:        "no condition",
+			rules:       `[{"index": "logs"}]`,
+			expectedErr: "ROUTING_RULES rule 1: at least one of bucket, key_prefix, key_glob and key_regex must be set",
+		},
+		{
+			name:        "no override",
+			rules:       `[{"index": "logs", "key_prefix": "logs/"}, {"key_prefix": "logs/"}]`,
+			expectedErr: "ROUTING_RULES rule 2: at least one of sourcetype, index, source, host, ep_host and decoder must be set",
+		},
+		{
+			name:        "invalid glob",
+			rules:       `[{"key_glob": "[logs", "index": "logs"}]`,
+			expectedErr: "ROUTING_RULES rule 1: key_glob \"[logs\" is not a valid glob",
+		},
+		{
+			name:        "invalid regex",
+			rules:       `[{"key_regex": "(logs", "index": "logs"}]`,
+			expectedErr: "ROUTING_RULES rule 1: key_regex \"(logs\" is not a valid regex",
+		},
+		{
+			name:        "unsupported decoder",
+			rules:       `[{"key_prefix": "logs/", "decoder": "xml"}]`,
+			expectedErr: "ROUTING_RULES rule 1: decoder xml is not supported",
+		},
+		{
+			name:        "invalid ep host",
+			rules:       `[{"key_prefix": "logs/", "ep_host": "ep:8088"}]`,
+			expectedErr: "ROUTING_RULES rule 1: ep_host must be an http or https url including the host",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseRoutingRules(tt.rules, nil)
+			assert.ErrorContains(t, err, tt.expectedErr)
+			assert.Nil(t, rules)
+		})
+	}
+}
+
+func Test_Config_route(t *testing.T) {
+	rules, err := parseRoutingRules(testRoutingRules, nil)
+	assert.NoError(t, err)
+	cfg := buildTestConfig(t)
+	cfg.RoutingRules = rules
+
+	tests := []struct {
+		name               string
+		bucket             string
+		key                string
+		expectedSourcetype string
+		expectedIndex      string
+		expectedEPHost     string
+	}{
+		{
+			name:               "bucket and prefix",
+			bucket:             "logs-bucket",
+			key:                "AWSLogs/123456789012/CloudTrail/us-west-2/2023/06/01/file.json.gz",
+			expectedSourcetype: "aws:cloudtrail",
+			expectedIndex:      "cloudtrail",
+			expectedEPHost:     "http://localhost",
+		},
+		{
+			name:               "prefix in another bucket",
+			bucket:             "other-bucket",
+			key:                "AWSLogs/123456789012/CloudTrail/us-west-2/2023/06/01/file.json.gz",
+			expectedSourcetype: cloudTrailSourcetype,
+			expectedIndex:      defaultIndex,
+			expectedEPHost:     "http://localhost",
+		},
+		{
+			name:               "glob",
+			bucket:             "logs-bucket",
+			key:                "prod/alb/file.log.gz",
+			expectedSourcetype: "aws:elb:accesslogs",
+			expectedIndex:      defaultIndex,
+			expectedEPHost:     "http://localhost",
+		},
+		{
+			name:               "regex",
+			bucket:             "logs-bucket",
+			key:                "app/api/file.log",
+			expectedSourcetype: defaultSourcetype,
+			expectedIndex:      "app",
+			expectedEPHost:     "http://app-ep:8088",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := buildTestRecord(tt.key)
+			record.S3.Bucket.Name = tt.bucket
+
+			routedCfg := cfg.route(record)
+			assert.Equal(t, tt.expectedSourcetype, routedCfg.Sourcetype)
+			assert.Equal(t, tt.expectedIndex, routedCfg.Index)
+			assert.Equal(t, tt.expectedEPHost, routedCfg.EPHost.String())
+		})
+	}
+
+	// the loaded configuration isn't changed by routed records
+	assert.Equal(t, defaultIndex, cfg.Index)
+}
+
+func Test_Config_route_explicitDefaultSourcetype_kept(t *testing.T) {
+	const cloudTrailKey = "AWSLogs/123456789012/CloudTrail/us-west-2/2023/06/01/file.json.gz"
+
+	t.Run("routing rule", func(t *testing.T) {
+		rules, err := parseRoutingRules("- key_prefix: AWSLogs/\n  sourcetype: "+defaultSourcetype, nil)
+		assert.NoError(t, err)
+		cfg := buildTestConfig(t)
+		cfg.RoutingRules = rules
+
+		assert.Equal(t, defaultSourcetype, cfg.route(buildTestRecord(cloudTrailKey)).Sourcetype)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		assert.NoError(t, os.Setenv(sourcetypeEnvKey, defaultSourcetype))
+		t.Cleanup(func() {
+			_ = os.Unsetenv(sourcetypeEnvKey)
+		})
+		cfg := buildTestConfig(t)
+
+		assert.Equal(t, defaultSourcetype, cfg.route(buildTestRecord(cloudTrailKey)).Sourcetype)
+	})
+}
+
+func Test_recordsProcessor_process_routingRules(t *testing.T) {
+	assert.NoError(t, os.Setenv(routingRulesEnvKey, testRoutingRules))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(routingRulesEnvKey)
+	})
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var defaultEvents, appEvents []hecEvent
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost"+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		var event hecEvent
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&event))
+		defaultEvents = append(defaultEvents, event)
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+	httpmock.RegisterResponder(http.MethodPost, "http://app-ep:8088"+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		var event hecEvent
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&event))
+		appEvents = append(appEvents, event)
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	s3Client := &objectsTestS3Client{
+		objects: map[string]string{
+			"app/web/file.log": "app-content",
+			"other/file.log":   "other-content",
+		},
+	}
+	h := newHandler(buildTestConfig(t), s3Client, &http.Client{}, &mapTestSecretsManagerClient{})
+	h.processor.concurrency = 1
+
+	errs := h.processor.process(context.Background(), []events.S3EventRecord{
+		buildTestRecord("app/web/file.log"),
+		buildTestRecord("other/file.log"),
+	})
+	assert.Equal(t, []error{nil, nil}, errs)
+
+	assert.Len(t, appEvents, 1)
+	assert.Equal(t, "app-content", appEvents[0].Event)
+	assert.Equal(t, "app", appEvents[0].Index)
+	assert.Equal(t, "app-logs", appEvents[0].Source)
+	assert.Equal(t, "app-host", appEvents[0].Host)
+
+	assert.Len(t, defaultEvents, 1)
+	assert.Equal(t, "other-content", defaultEvents[0].Event)
+	assert.Equal(t, defaultIndex, defaultEvents[0].Index)
+}
@@ -1,23 +1,44 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
 )
 
+const (
+	gzipContentType  = "application/gzip"
+	xGzipContentType = "application/x-gzip"
+
+	// invalidRangeErrorCode is returned by S3 when the requested range starts after the end of the object
+	invalidRangeErrorCode = "InvalidRange"
+)
+
+var gzipMagicBytes = []byte{0x1f, 0x8b}
+
 type S3Client interface {
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 }
 
-func fetchS3Content(ctx context.Context, s3Client S3Client, record events.S3EventRecord) ([]byte, error) {
+// fetchS3Content returns a reader streaming the S3 object content. gzip content is decompressed on the fly.
+// Objects marked as gzip by their Content-Encoding/Content-Type metadata must have gzip content.
+func fetchS3Content(ctx context.Context, s3Client S3Client, record events.S3EventRecord) (*s3ContentReader, error) {
 	s3Object, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(record.S3.Bucket.Name),
-		Key:    aws.String(record.S3.Object.Key),
+		Key:    aws.String(getObjectKey(record)),
 	})
 
 	if err != nil {
@@ -25,5 +46,155 @@ func fetchS3Content(ctx context.Context, s3Client S3Client, record events.S3Even
 		return nil, err
 	}
 
-	return io.ReadAll(s3Object.Body)
+	bufferedBody := bufio.NewReader(s3Object.Body)
+	magicBytes, _ := bufferedBody.Peek(len(parquetMagicBytes))
+	if !bytes.HasPrefix(magicBytes, gzipMagicBytes) {
+		if len(magicBytes) > 0 && isGzipObject(s3Object) {
+			_ = s3Object.Body.Close()
+			return nil, fmt.Errorf("s3 object %s is marked as gzip by its metadata but its content is not gzip compressed", getObjectKey(record))
+		}
+		var parquetObject *s3ObjectReaderAt
+		if bytes.Equal(magicBytes, parquetMagicBytes) {
+			parquetObject = &s3ObjectReaderAt{
+				ctx:          ctx,
+				s3Client:     s3Client,
+				bucket:       record.S3.Bucket.Name,
+				key:          getObjectKey(record),
+				eTag:         s3Object.ETag,
+				size:         s3Object.ContentLength,
+				lastModified: aws.ToTime(s3Object.LastModified),
+			}
+		}
+		return &s3ContentReader{Reader: bufferedBody, body: s3Object.Body, lastModified: aws.ToTime(s3Object.LastModified), parquetObject: parquetObject}, nil
+	}
+
+	gzipReader, err := gzip.NewReader(bufferedBody)
+	if err != nil {
+		_ = s3Object.Body.Close()
+		return nil, err
+	}
+	return &s3ContentReader{Reader: gzipReader, body: s3Object.Body, lastModified: aws.ToTime(s3Object.LastModified)}, nil
+}
+
+// getObjectKey returns the url decoded key of the record object.
+// S3 event notifications url encode object keys.
+func getObjectKey(record events.S3EventRecord) string {
+	if record.S3.Object.URLDecodedKey != "" {
+		return record.S3.Object.URLDecodedKey
+	}
+	return record.S3.Object.Key
+}
+
+// s3ContentReader reads the (decompressed) content and closes the underlying S3 object body.
+type s3ContentReader struct {
+	io.Reader
+	body         io.Closer
+	lastModified time.Time
+	// parquetObject is set if the content starts with the Parquet magic bytes, to read the same version
+	// of the object with ranged requests instead
+	parquetObject *s3ObjectReaderAt
+}
+
+func (r *s3ContentReader) Close() error {
+	return r.body.Close()
+}
+
+// isGzipObject checks the object metadata to see if S3 content is gzip compressed.
+func isGzipObject(s3Object *s3.GetObjectOutput) bool {
+	contentEncoding := strings.ToLower(aws.ToString(s3Object.ContentEncoding))
+	if strings.Contains(contentEncoding, gzipEncoding) {
+		return true
+	}
+
+	contentType := strings.ToLower(aws.ToString(s3Object.ContentType))
+	return contentType == gzipContentType || contentType == xGzipContentType
+}
+
+// s3ObjectReaderAt reads an S3 object with ranged requests so only the parts which are read are downloaded.
+// Requests only match the version of the object which was opened.
+type s3ObjectReaderAt struct {
+	ctx          context.Context
+	s3Client     S3Client
+	bucket       string
+	key          string
+	eTag         *string
+	size         int64
+	lastModified time.Time
+}
+
+// errEmptyS3Object is returned when opening an empty object, which has no range to request.
+var errEmptyS3Object = errors.New("s3 object is empty")
+
+// openS3Object gets the size of the record object with a request for its first byte.
+func openS3Object(ctx context.Context, s3Client S3Client, record events.S3EventRecord) (*s3ObjectReaderAt, error) {
+	object := &s3ObjectReaderAt{
+		ctx:      ctx,
+		s3Client: s3Client,
+		bucket:   record.S3.Bucket.Name,
+		key:      getObjectKey(record),
+	}
+	s3Object, err := object.getRange(0, 0)
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == invalidRangeErrorCode {
+		return nil, errEmptyS3Object
+	}
+	if err != nil {
+		log.Printf("error fetching s3 object: %s", err)
+		return nil, err
+	}
+	defer s3Object.Body.Close()
+
+	if object.size, err = parseContentRangeSize(aws.ToString(s3Object.ContentRange)); err != nil {
+		return nil, err
+	}
+	object.eTag = s3Object.ETag
+	object.lastModified = aws.ToTime(s3Object.LastModified)
+	return object, nil
+}
+
+func (o *s3ObjectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= o.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	last := off + int64(len(p)) - 1
+	if last >= o.size {
+		last = o.size - 1
+	}
+	s3Object, err := o.getRange(off, last)
+	if err != nil {
+		return 0, err
+	}
+	defer s3Object.Body.Close()
+
+	n, err := io.ReadFull(s3Object.Body, p[:last-off+1])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (o *s3ObjectReaderAt) getRange(first, last int64) (*s3.GetObjectOutput, error) {
+	return o.s3Client.GetObject(o.ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(o.bucket),
+		Key:     aws.String(o.key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+		IfMatch: o.eTag,
+	})
+}
+
+// parseContentRangeSize returns the object size of a Content-Range header such as bytes 0-0/1234.
+func parseContentRangeSize(contentRange string) (int64, error) {
+	_, sizeStr, found := strings.Cut(contentRange, "/")
+	if !found {
+		return 0, errors.New("s3 object has no content range")
+	}
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("s3 object content range %q has no size", contentRange)
+	}
+	return size, nil
 }
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,6 +30,60 @@ func (s *staticTestS3Client) GetObject(_ context.Context, params *s3.GetObjectIn
 	return s.output, s.err
 }
 
+// objectsTestS3Client serves objects by key, or their range if requested, and records fetched keys and ranges.
+type objectsTestS3Client struct {
+	mu            sync.Mutex
+	objects       map[string]string
+	fetchedKeys   []string
+	fetchedRanges []string
+}
+
+func (o *objectsTestS3Client) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	key := aws.ToString(params.Key)
+	o.fetchedKeys = append(o.fetchedKeys, key)
+	content, ok := o.objects[key]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	if params.Range == nil {
+		return &s3.GetObjectOutput{
+			Body:          io.NopCloser(strings.NewReader(content)),
+			ContentLength: int64(len(content)),
+			ETag:          aws.String(`"test-etag"`),
+		}, nil
+	}
+
+	o.fetchedRanges = append(o.fetchedRanges, aws.ToString(params.Range))
+	var first, last int
+	if _, err := fmt.Sscanf(aws.ToString(params.Range), "bytes=%d-%d", &first, &last); err != nil {
+		return nil, err
+	}
+	if first >= len(content) {
+		return nil, &smithy.GenericAPIError{Code: invalidRangeErrorCode, Message: "The requested range is not satisfiable"}
+	}
+	if last >= len(content) {
+		last = len(content) - 1
+	}
+	return &s3.GetObjectOutput{
+		Body:         io.NopCloser(strings.NewReader(content[first : last+1])),
+		ContentRange: aws.String(fmt.Sprintf("bytes %d-%d/%d", first, last, len(content))),
+		ETag:         aws.String(`"test-etag"`),
+	}, nil
+}
+
+func fetchTestS3Content(t *testing.T, s3Client S3Client, record events.S3EventRecord) string {
+	reader, err := fetchS3Content(context.Background(), s3Client, record)
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(content)
+}
+
 func Test_fetchS3Content_success(t *testing.T) {
 	const (
 		bucketName = "test-bucket"
@@ -44,9 +105,8 @@ func Test_fetchS3Content_success(t *testing.T) {
 			},
 		},
 	}
-	content, err := fetchS3Content(context.Background(), s3Client, record)
-	assert.NoError(t, err)
-	assert.Equal(t, s3Content, string(content))
+	content := fetchTestS3Content(t, s3Client, record)
+	assert.Equal(t, s3Content, content)
 
 	assert.NotNil(t, s3Client.params)
 	assert.NotNil(t, bucketName, s3Client.params.Bucket)
@@ -71,3 +131,188 @@ func Test_fetchS3Content_error(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, content)
 }
+
+func Test_fetchS3Content_gzipContent_decompressed(t *testing.T) {
+	const s3Content = "test-content"
+
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, err := gzipWriter.Write([]byte(s3Content))
+	assert.NoError(t, err)
+	assert.NoError(t, gzipWriter.Close())
+
+	tests := []struct {
+		name   string
+		output *s3.GetObjectOutput
+	}{
+		{
+			name: "detected by content encoding",
+			output: &s3.GetObjectOutput{
+				ContentEncoding: aws.String(gzipEncoding),
+				Body:            io.NopCloser(bytes.NewReader(compressed.Bytes())),
+			},
+		},
+		{
+			name: "detected by content type",
+			output: &s3.GetObjectOutput{
+				ContentType: aws.String(gzipContentType),
+				Body:        io.NopCloser(bytes.NewReader(compressed.Bytes())),
+			},
+		},
+		{
+			name: "detected by magic bytes",
+			output: &s3.GetObjectOutput{
+				Body: io.NopCloser(bytes.NewReader(compressed.Bytes())),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := &staticTestS3Client{
+				output: tt.output,
+			}
+			content := fetchTestS3Content(t, s3Client, events.S3EventRecord{})
+			assert.Equal(t, s3Content, content)
+		})
+	}
+}
+
+func Test_fetchS3Content_gzipMetadataWithPlainContent_error(t *testing.T) {
+	tests := []struct {
+		name   string
+		output *s3.GetObjectOutput
+	}{
+		{
+			name: "content encoding",
+			output: &s3.GetObjectOutput{
+				ContentEncoding: aws.String(gzipEncoding),
+				Body:            io.NopCloser(strings.NewReader("test-content")),
+			},
+		},
+		{
+			name: "content type",
+			output: &s3.GetObjectOutput{
+				ContentType: aws.String(xGzipContentType),
+				Body:        io.NopCloser(strings.NewReader("test-content")),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Client := &staticTestS3Client{output: tt.output}
+			record := events.S3EventRecord{S3: events.S3Entity{Object: events.S3Object{Key: "test-key"}}}
+			content, err := fetchS3Content(context.Background(), s3Client, record)
+			assert.EqualError(t, err, "s3 object test-key is marked as gzip by its metadata but its content is not gzip compressed")
+			assert.Nil(t, content)
+		})
+	}
+}
+
+func Test_fetchS3Content_gzipMetadataWithEmptyContent_empty(t *testing.T) {
+	s3Client := &staticTestS3Client{
+		output: &s3.GetObjectOutput{
+			ContentEncoding: aws.String(gzipEncoding),
+			Body:            io.NopCloser(strings.NewReader("")),
+		},
+	}
+
+	content := fetchTestS3Content(t, s3Client, events.S3EventRecord{})
+	assert.Empty(t, content)
+}
+
+func Test_fetchS3Content_lastModified(t *testing.T) {
+	lastModified := time.UnixMilli(1685620800000)
+	s3Client := &staticTestS3Client{
+		output: &s3.GetObjectOutput{
+			Body:         io.NopCloser(strings.NewReader("test-content")),
+			LastModified: aws.Time(lastModified),
+		},
+	}
+
+	reader, err := fetchS3Content(context.Background(), s3Client, buildTestRecord("test-key"))
+	assert.NoError(t, err)
+	defer reader.Close()
+	assert.Equal(t, lastModified, reader.lastModified)
+}
+
+func Test_s3ObjectReaderAt_ReadAt(t *testing.T) {
+	s3Client := &objectsTestS3Client{objects: map[string]string{"test-key": "0123456789"}}
+	object, err := openS3Object(context.Background(), s3Client, buildTestRecord("test-key"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), object.size)
+
+	buf := make([]byte, 4)
+	n, err := object.ReadAt(buf, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "2345", string(buf[:n]))
+
+	n, err = object.ReadAt(buf, 8)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, "89", string(buf[:n]))
+
+	n, err = object.ReadAt(buf, 10)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Zero(t, n)
+
+	// only the requested ranges are downloaded
+	assert.Equal(t, []string{"bytes=0-0", "bytes=2-5", "bytes=8-9"}, s3Client.fetchedRanges)
+}
+
+func Test_openS3Object_readsOnlyOpenedVersion(t *testing.T) {
+	s3Client := &staticTestS3Client{
+		output: &s3.GetObjectOutput{
+			Body:         io.NopCloser(strings.NewReader("P")),
+			ContentRange: aws.String("bytes 0-0/1234"),
+			ETag:         aws.String(`"etag"`),
+			LastModified: aws.Time(time.UnixMilli(1600000000000)),
+		},
+	}
+	object, err := openS3Object(context.Background(), s3Client, buildTestRecord("test-key"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1234), object.size)
+	assert.Equal(t, time.UnixMilli(1600000000000), object.lastModified)
+
+	s3Client.output.Body = io.NopCloser(strings.NewReader("AR1"))
+	_, err = object.ReadAt(make([]byte, 3), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "bytes=1-3", aws.ToString(s3Client.params.Range))
+	assert.Equal(t, `"etag"`, aws.ToString(s3Client.params.IfMatch))
+}
+
+func Test_openS3Object_emptyObject_error(t *testing.T) {
+	s3Client := &objectsTestS3Client{objects: map[string]string{"test-key": ""}}
+	_, err := openS3Object(context.Background(), s3Client, buildTestRecord("test-key"))
+	assert.ErrorIs(t, err, errEmptyS3Object)
+}
+
+func Test_fetchS3Content_parquetContent_detected(t *testing.T) {
+	s3Client := &objectsTestS3Client{objects: map[string]string{"parquet": "PAR1...PAR1", "text": "PAR", "empty": ""}}
+	for key, expected := range map[string]bool{"parquet": true, "text": false, "empty": false} {
+		reader, err := fetchS3Content(context.Background(), s3Client, buildTestRecord(key))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, reader.parquetObject != nil, key)
+		assert.NoError(t, reader.Close())
+	}
+
+	// the object is read with ranged requests without requesting its size again
+	reader, err := fetchS3Content(context.Background(), s3Client, buildTestRecord("parquet"))
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, int64(len("PAR1...PAR1")), reader.parquetObject.size)
+	assert.Equal(t, `"test-etag"`, aws.ToString(reader.parquetObject.eTag))
+	buf := make([]byte, 3)
+	_, err = reader.parquetObject.ReadAt(buf, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "...", string(buf))
+	assert.Equal(t, []string{"bytes=4-6"}, s3Client.fetchedRanges)
+}
+
+func Test_parseContentRangeSize_invalid_error(t *testing.T) {
+	_, err := parseContentRangeSize("")
+	assert.EqualError(t, err, "s3 object has no content range")
+
+	_, err = parseContentRangeSize("bytes 0-0/*")
+	assert.EqualError(t, err, `s3 object content range "bytes 0-0/*" has no size`)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"time"
+)
+
+const (
+	s3AccessLogSourcetype = "aws:s3:accesslogs"
+
+	s3AccessLogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+)
+
+// s3AccessLogKeyRegex matches the keys of S3 server access log files, with the simple or the date-based
+// partitioned prefix: [prefix/]yyyy-mm-dd-hh-mm-ss-unique-id
+var s3AccessLogKeyRegex = regexp.MustCompile(`(^|/)\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2}-[0-9A-F]{16}$`)
+
+// s3AccessLogTimeRegex matches the bracketed time of the request, which follows the bucket owner and bucket.
+var s3AccessLogTimeRegex = regexp.MustCompile(`^\S+ \S+ \[([^\]]+)\]`)
+
+// s3AccessLogDecoder emits each request of an S3 server access log file as an event with the time
+// of the request.
+type s3AccessLogDecoder struct {
+	maxEventSize int
+}
+
+func (d *s3AccessLogDecoder) decode(reader io.Reader, emit func(event decodedEvent) error) error {
+	return decodeLines(reader, d.maxEventSize, func(line string) error {
+		event := decodedEvent{content: line}
+		if match := s3AccessLogTimeRegex.FindStringSubmatch(line); match != nil {
+			if eventTime, err := time.Parse(s3AccessLogTimeLayout, match[1]); err == nil {
+				event.time = eventTime
+			}
+		}
+		return emit(event)
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testS3AccessLogLine = `79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be DOC-EXAMPLE-BUCKET1 ` +
+	`[06/Feb/2019:00:00:38 +0000] 192.0.2.3 79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be ` +
+	`3E57427F3EXAMPLE REST.GET.VERSIONING - "GET /DOC-EXAMPLE-BUCKET1?versioning HTTP/1.1" 200 - 113 - 7 - "-" "S3Console/0.4" -`
+
+func Test_s3AccessLogDecoder_decode(t *testing.T) {
+	content := testS3AccessLogLine + "\n" + "unknown log line\n"
+
+	var decodedEvents []decodedEvent
+	err := (&s3AccessLogDecoder{maxEventSize: defaultMaxEventSize}).decode(strings.NewReader(content), func(event decodedEvent) error {
+		decodedEvents = append(decodedEvents, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, decodedEvents, 2)
+	assert.Equal(t, testS3AccessLogLine, decodedEvents[0].content)
+	assert.True(t, time.Date(2019, 2, 6, 0, 0, 38, 0, time.UTC).Equal(decodedEvents[0].time))
+	assert.Equal(t, decodedEvent{content: "unknown log line"}, decodedEvents[1])
+}
+
+func Test_s3AccessLogDecoder_decode_lineBiggerThanMaxEventSize_truncated(t *testing.T) {
+	content := testS3AccessLogLine + strings.Repeat("x", 10000) + "\nunknown log line\n"
+
+	var decodedEvents []decodedEvent
+	err := (&s3AccessLogDecoder{maxEventSize: len(testS3AccessLogLine)}).decode(strings.NewReader(content), func(event decodedEvent) error {
+		decodedEvents = append(decodedEvents, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, decodedEvents, 2)
+	assert.Equal(t, testS3AccessLogLine, decodedEvents[0].content)
+	assert.True(t, time.Date(2019, 2, 6, 0, 0, 38, 0, time.UTC).Equal(decodedEvents[0].time))
+	assert.Equal(t, decodedEvent{content: "unknown log line"}, decodedEvents[1])
+}
+
+func Test_recordsProcessor_process_accessLogs(t *testing.T) {
+	const (
+		cloudFrontKey  = "cloudfront/E2EXAMPLE1ABC.2019-12-04-21.a1b2c3d4.gz"
+		s3AccessLogKey = "s3-logs/123456789012/us-west-1/DOC-EXAMPLE-BUCKET1/2019/02/06/2019-02-06-00-00-38-5A3D9F8B2C1E4D7A"
+	)
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var hecEvents []hecEvent
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost"+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		decoder := json.NewDecoder(req.Body)
+		for decoder.More() {
+			var event hecEvent
+			assert.NoError(t, decoder.Decode(&event))
+			hecEvents = append(hecEvents, event)
+		}
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	s3Client := &objectsTestS3Client{
+		objects: map[string]string{
+			cloudFrontKey:  testCloudFrontLogFile,
+			s3AccessLogKey: testS3AccessLogLine,
+		},
+	}
+	h := newHandler(buildTestConfig(t), s3Client, &http.Client{}, &mapTestSecretsManagerClient{})
+	h.processor.concurrency = 1
+
+	errs := h.processor.process(context.Background(), []events.S3EventRecord{
+		buildTestRecord(cloudFrontKey),
+		buildTestRecord(s3AccessLogKey),
+	})
+	assert.Equal(t, []error{nil, nil}, errs)
+
+	assert.Len(t, hecEvents, 3)
+	assert.Equal(t, cloudFrontSourcetype, hecEvents[0].Sourcetype)
+	assert.Equal(t, float64(1575493351), hecEvents[0].Time)
+	assert.Equal(t, float64(1575493352), hecEvents[1].Time)
+	assert.Equal(t, s3AccessLogSourcetype, hecEvents[2].Sourcetype)
+	assert.Equal(t, float64(1549411238), hecEvents[2].Time)
+	assert.Equal(t, testS3AccessLogLine, hecEvents[2].Event)
+}
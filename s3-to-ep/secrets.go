@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+const (
+	epTLSClientCertSecretEnvKey       = "TLS_CLIENT_CERT_SECRET_ARN"
+	epTLSClientPrivateKeySecretEnvKey = "TLS_CLIENT_KEY_SECRET_ARN"
+	epTLSCACertSecretEnvKey           = "TLS_CLIENT_CA_CERT_SECRET_ARN"
+	hecTokenSecretEnvKey              = "HEC_TOKEN_SECRET_ARN"
+	secretsCacheTTLEnvKey             = "SECRETS_CACHE_TTL"
+
+	defaultSecretsCacheTTL = 5 * time.Minute
+	secretsManagerService  = "secretsmanager"
+)
+
+type SecretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// parseSecretARN validates secretARN is a Secrets Manager ARN. Empty values are accepted.
+func parseSecretARN(key, secretARN string) (string, error) {
+	if secretARN == "" {
+		return "", nil
+	}
+
+	parsedARN, err := arn.Parse(secretARN)
+	if err != nil || parsedARN.Service != secretsManagerService {
+		return "", fmt.Errorf("%s must be a Secrets Manager secret ARN", key)
+	}
+	return secretARN, nil
+}
+
+// validateSecretARNs checks values aren't set both directly and as a secret.
+func validateSecretARNs(getenv func(string) string, cfg *Config) error {
+	var errs []error
+	for _, keys := range [][2]string{
+		{epTLSClientCertEnvKey, epTLSClientCertSecretEnvKey},
+		{epTLSClientPrivateKeyEnvKey, epTLSClientPrivateKeySecretEnvKey},
+		{epTLSCACertEnvKey, epTLSCACertSecretEnvKey},
+		{hecTokenEnvKey, hecTokenSecretEnvKey},
+	} {
+		if getenv(keys[0]) != "" && getenv(keys[1]) != "" {
+			errs = append(errs, fmt.Errorf("only one of %s and %s can be set", keys[0], keys[1]))
+		}
+	}
+	if (cfg.TLSClientCertSecretARN == "") != (cfg.TLSClientKeySecretARN == "") {
+		errs = append(errs, fmt.Errorf("%s and %s must be set together", epTLSClientCertSecretEnvKey, epTLSClientPrivateKeySecretEnvKey))
+	}
+	return errors.Join(errs...)
+}
+
+// hasSecrets is true if any value is stored in Secrets Manager.
+func (cfg *Config) hasSecrets() bool {
+	return cfg.TLSClientCertSecretARN != "" || cfg.TLSCACertSecretARN != "" || cfg.HECTokenSecretARN != ""
+}
+
+type cachedSecret struct {
+	value     string
+	expiresAt time.Time
+}
+
+// secretsCache keeps secret values for ttl so warm invocations don't call Secrets Manager every time,
+// while rotated secrets are picked up once the ttl expires.
+type secretsCache struct {
+	client SecretsManagerClient
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	secrets map[string]cachedSecret
+}
+
+func newSecretsCache(client SecretsManagerClient, ttl time.Duration) *secretsCache {
+	return &secretsCache{
+		client:  client,
+		ttl:     ttl,
+		now:     time.Now,
+		secrets: make(map[string]cachedSecret),
+	}
+}
+
+// get returns the value of the secret. If the secret can't be fetched once expired, the expired value
+// is used so an outage of Secrets Manager doesn't stop the ingestion.
+func (c *secretsCache) get(ctx context.Context, secretARN string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, found := c.secrets[secretARN]
+	if found && c.now().Before(cached.expiresAt) {
+		return cached.value, nil
+	}
+
+	output, err := c.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretARN),
+	})
+	if err != nil {
+		if found {
+			log.Printf("error refreshing secret %s, using the cached value: %s", secretARN, err)
+			return cached.value, nil
+		}
+		return "", fmt.Errorf("error fetching secret %s: %w", secretARN, err)
+	}
+
+	value := aws.ToString(output.SecretString)
+	if output.SecretString == nil {
+		value = string(output.SecretBinary)
+	}
+	c.secrets[secretARN] = cachedSecret{
+		value:     value,
+		expiresAt: c.now().Add(c.ttl),
+	}
+	return value, nil
+}
+
+// secretValues are the values a resolved configuration was built from.
+type secretValues struct {
+	clientCert string
+	clientKey  string
+	caCert     string
+	hecToken   string
+}
+
+// secretsResolver completes the configuration with the values stored in Secrets Manager.
+// The configuration is only rebuilt when a secret value changes. httpClient is only replaced when
+// TLS secrets change, so TLS sessions are kept as long as the certificates aren't rotated.
+type secretsResolver struct {
+	cfg   *Config
+	cache *secretsCache
+
+	mu          sync.Mutex
+	values      secretValues
+	resolvedCfg *Config
+	httpClient  *http.Client
+}
+
+func newSecretsResolver(cfg *Config, httpClient *http.Client, client SecretsManagerClient) *secretsResolver {
+	return &secretsResolver{
+		cfg:        cfg,
+		cache:      newSecretsCache(client, cfg.SecretsCacheTTL),
+		httpClient: httpClient,
+	}
+}
+
+func (r *secretsResolver) resolve(ctx context.Context) (*Config, *http.Client, error) {
+	var values secretValues
+	for _, secret := range []struct {
+		secretARN string
+		value     *string
+	}{
+		{secretARN: r.cfg.TLSClientCertSecretARN, value: &values.clientCert},
+		{secretARN: r.cfg.TLSClientKeySecretARN, value: &values.clientKey},
+		{secretARN: r.cfg.TLSCACertSecretARN, value: &values.caCert},
+		{secretARN: r.cfg.HECTokenSecretARN, value: &values.hecToken},
+	} {
+		if secret.secretARN == "" {
+			continue
+		}
+		value, err := r.cache.get(ctx, secret.secretARN)
+		if err != nil {
+			return nil, nil, err
+		}
+		*secret.value = value
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.resolvedCfg != nil && values == r.values {
+		return r.resolvedCfg, r.httpClient, nil
+	}
+
+	resolvedCfg := *r.cfg
+	if values.hecToken != "" {
+		resolvedCfg.HECToken = values.hecToken
+	}
+	if values.clientCert != "" {
+		cert, err := parseTLSCertificate(values.clientCert, values.clientKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid secret: %w", err)
+		}
+		resolvedCfg.TLSCertificate = cert
+	}
+	if values.caCert != "" {
+		rootCAs, err := parseTLSRootCAs(values.caCert)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid secret: %w", err)
+		}
+		resolvedCfg.TLSRootCAs = rootCAs
+	}
+
+	tlsChanged := values.clientCert != r.values.clientCert || values.clientKey != r.values.clientKey || values.caCert != r.values.caCert
+	if tlsChanged {
+		if r.resolvedCfg != nil {
+			log.Printf("TLS secrets have changed. Rebuilding http client")
+			r.httpClient.CloseIdleConnections()
+		}
+		r.httpClient = buildHTTPClient(&resolvedCfg)
+	}
+	r.values = values
+	r.resolvedCfg = &resolvedCfg
+	return r.resolvedCfg, r.httpClient, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testCertSecretARN  = "arn:aws:secretsmanager:us-west-2:123456789012:secret:ep-client-cert-AbCdEf"
+	testKeySecretARN   = "arn:aws:secretsmanager:us-west-2:123456789012:secret:ep-client-key-AbCdEf"
+	testCASecretARN    = "arn:aws:secretsmanager:us-west-2:123456789012:secret:ep-ca-cert-AbCdEf"
+	testTokenSecretARN = "arn:aws:secretsmanager:us-west-2:123456789012:secret:hec-token-AbCdEf"
+)
+
+// mapTestSecretsManagerClient serves secrets by ARN and counts the calls.
+type mapTestSecretsManagerClient struct {
+	mu      sync.Mutex
+	secrets map[string]string
+	err     error
+	calls   int
+}
+
+func (c *mapTestSecretsManagerClient) GetSecretValue(_ context.Context, params *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	value, ok := c.secrets[aws.ToString(params.SecretId)]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+func (c *mapTestSecretsManagerClient) setSecret(secretARN, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.secrets[secretARN] = value
+}
+
+func Test_loadConfig_invalidSecretEnv_error(t *testing.T) {
+	tests := []struct {
+		name        string
+		envs        map[string]string
+		expectedErr string
+	}{
+		{
+			name: "not an arn",
+			envs: map[string]string{
+				hecTokenSecretEnvKey: "hec-token",
+			},
+			expectedErr: "HEC_TOKEN_SECRET_ARN must be a Secrets Manager secret ARN",
+		},
+		{
+			name: "not a secrets manager arn",
+			envs: map[string]string{
+				hecTokenSecretEnvKey: "arn:aws:ssm:us-west-2:123456789012:parameter/hec-token",
+			},
+			expectedErr: "HEC_TOKEN_SECRET_ARN must be a Secrets Manager secret ARN",
+		},
+		{
+			name: "value set directly and as a secret",
+			envs: map[string]string{
+				hecTokenEnvKey:       "test-token",
+				hecTokenSecretEnvKey: testTokenSecretARN,
+			},
+			expectedErr: "only one of HEC_TOKEN and HEC_TOKEN_SECRET_ARN can be set",
+		},
+		{
+			name: "client cert secret without key secret",
+			envs: map[string]string{
+				epTLSClientCertSecretEnvKey: testCertSecretARN,
+			},
+			expectedErr: "TLS_CLIENT_CERT_SECRET_ARN and TLS_CLIENT_KEY_SECRET_ARN must be set together",
+		},
+	}
+
+	assert.NoError(t, os.Setenv(epHostEnvKey, "https://localhost"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, val := range tt.envs {
+				assert.NoError(t, os.Setenv(key, val))
+			}
+			t.Cleanup(func() {
+				for key := range tt.envs {
+					_ = os.Unsetenv(key)
+				}
+			})
+
+			cfg, err := loadConfig(os.Getenv)
+			assert.EqualError(t, err, tt.expectedErr)
+			assert.Nil(t, cfg)
+		})
+	}
+}
+
+func Test_secretsCache_get(t *testing.T) {
+	client := &mapTestSecretsManagerClient{
+		secrets: map[string]string{testTokenSecretARN: "token-1"},
+	}
+	cache := newSecretsCache(client, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time {
+		return now
+	}
+	ctx := context.Background()
+
+	value, err := cache.get(ctx, testTokenSecretARN)
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", value)
+
+	// cached value is used until the ttl expires
+	client.setSecret(testTokenSecretARN, "token-2")
+	value, err = cache.get(ctx, testTokenSecretARN)
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", value)
+	assert.Equal(t, 1, client.calls)
+
+	now = now.Add(time.Minute)
+	value, err = cache.get(ctx, testTokenSecretARN)
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", value)
+	assert.Equal(t, 2, client.calls)
+
+	// expired value is used if the secret can't be refreshed
+	now = now.Add(time.Minute)
+	client.err = errors.New("throttled")
+	value, err = cache.get(ctx, testTokenSecretARN)
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", value)
+
+	_, err = cache.get(ctx, testCASecretARN)
+	assert.Error(t, err)
+}
+
+func Test_secretsResolver_resolve_hecToken_keepsHTTPClient(t *testing.T) {
+	assert.NoError(t, os.Setenv(hecTokenSecretEnvKey, testTokenSecretARN))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(hecTokenSecretEnvKey)
+	})
+	cfg := buildTestConfig(t)
+	client := &mapTestSecretsManagerClient{
+		secrets: map[string]string{testTokenSecretARN: "token-1"},
+	}
+	httpClient := &http.Client{}
+	resolver := newSecretsResolver(cfg, httpClient, client)
+	resolver.cache.ttl = 0
+	ctx := context.Background()
+
+	resolvedCfg, resolvedClient, err := resolver.resolve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", resolvedCfg.HECToken)
+	assert.Empty(t, cfg.HECToken)
+	assert.Same(t, httpClient, resolvedClient)
+
+	client.setSecret(testTokenSecretARN, "token-2")
+	resolvedCfg, resolvedClient, err = resolver.resolve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", resolvedCfg.HECToken)
+	assert.Same(t, httpClient, resolvedClient)
+}
+
+func Test_secretsResolver_resolve_tlsSecrets_rebuildsHTTPClientOnRotation(t *testing.T) {
+	assert.NoError(t, os.Setenv(epTLSClientCertSecretEnvKey, testCertSecretARN))
+	assert.NoError(t, os.Setenv(epTLSClientPrivateKeySecretEnvKey, testKeySecretARN))
+	assert.NoError(t, os.Setenv(epTLSCACertSecretEnvKey, testCASecretARN))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epTLSClientCertSecretEnvKey)
+		_ = os.Unsetenv(epTLSClientPrivateKeySecretEnvKey)
+		_ = os.Unsetenv(epTLSCACertSecretEnvKey)
+	})
+	cfg := buildTestConfig(t)
+	client := &mapTestSecretsManagerClient{
+		secrets: map[string]string{
+			testCertSecretARN: testTLSCert,
+			testKeySecretARN:  testTLSKey,
+			testCASecretARN:   testTLSCACert,
+		},
+	}
+	resolver := newSecretsResolver(cfg, &http.Client{}, client)
+	resolver.cache.ttl = 0
+	ctx := context.Background()
+
+	resolvedCfg, resolvedClient, err := resolver.resolve(ctx)
+	assert.NoError(t, err)
+	assert.NotNil(t, resolvedCfg.TLSCertificate)
+	assert.NotNil(t, resolvedCfg.TLSRootCAs)
+	transport, isHTTPTransport := resolvedClient.Transport.(*http.Transport)
+	assert.True(t, isHTTPTransport)
+	assert.NotEmpty(t, transport.TLSClientConfig.Certificates)
+
+	// unchanged secrets reuse the same client
+	sameCfg, sameClient, err := resolver.resolve(ctx)
+	assert.NoError(t, err)
+	assert.Same(t, resolvedCfg, sameCfg)
+	assert.Same(t, resolvedClient, sameClient)
+
+	client.setSecret(testKeySecretARN, "not-a-key")
+	_, _, err = resolver.resolve(ctx)
+	assert.Error(t, err)
+
+	client.setSecret(testKeySecretARN, testTLSKey+"\n")
+	_, rotatedClient, err := resolver.resolve(ctx)
+	assert.NoError(t, err)
+	assert.NotSame(t, resolvedClient, rotatedClient)
+}
+
+func Test_recordsProcessor_process_hecTokenSecret(t *testing.T) {
+	const testURL = "http://localhost"
+	assert.NoError(t, os.Setenv(epHostEnvKey, testURL))
+	assert.NoError(t, os.Setenv(hecTokenSecretEnvKey, testTokenSecretARN))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+		_ = os.Unsetenv(hecTokenSecretEnvKey)
+	})
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var authorizations []string
+	httpmock.RegisterResponder(http.MethodPost, testURL+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		authorizations = append(authorizations, req.Header.Get(httpAuthorizationHeader))
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	s3Client := &objectsTestS3Client{
+		objects: map[string]string{"key-1": "content-1"},
+	}
+	secretsClient := &mapTestSecretsManagerClient{
+		secrets: map[string]string{testTokenSecretARN: "secret-token"},
+	}
+	h := newHandler(buildTestConfig(t), s3Client, &http.Client{}, secretsClient)
+
+	errs := h.processor.process(context.Background(), []events.S3EventRecord{buildTestRecord("key-1")})
+	assert.Equal(t, []error{nil}, errs)
+	assert.Equal(t, []string{"Splunk secret-token"}, authorizations)
+
+	// records fail if the secret can't be fetched
+	h = newHandler(buildTestConfig(t), s3Client, &http.Client{}, &mapTestSecretsManagerClient{err: errors.New("access denied")})
+	errs = h.processor.process(context.Background(), []events.S3EventRecord{buildTestRecord("key-1")})
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "access denied")
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// SNSHandler processes S3 event notifications published to SNS topics.
+func (h *handler) SNSHandler(ctx context.Context, snsEvent events.SNSEvent) error {
+	var records []events.S3EventRecord
+	for _, snsRecord := range snsEvent.Records {
+		s3Records, err := parseS3Notification([]byte(snsRecord.SNS.Message))
+		if err != nil {
+			log.Printf("error parsing sns message %s: %s", snsRecord.SNS.MessageID, err)
+			return err
+		}
+		records = append(records, s3Records...)
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	return h.S3Handler(ctx, events.S3Event{Records: records})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// SQSHandler processes S3 event notifications delivered through SQS, either directly, through SNS or through EventBridge.
+// Failed messages are reported in the response so only those are redelivered.
+func (h *handler) SQSHandler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
+	log.Printf("receiving SQS Event messages. Count: %d", len(sqsEvent.Records))
+	return handleSQSMessages(ctx, h.processor, sqsEvent.Records), nil
+}
+
+// handleSQSMessages sends the records of all messages together. A message fails if it can't be parsed
+// or if any of its records fails.
+func handleSQSMessages(ctx context.Context, processor *recordsProcessor, messages []events.SQSMessage) events.SQSEventResponse {
+	var records []events.S3EventRecord
+	var recordMessageIDs []string
+	failedMessageIDs := make(map[string]bool)
+	for _, message := range messages {
+		messageRecords, err := parseS3Notification([]byte(message.Body))
+		if err != nil {
+			log.Printf("error parsing sqs message %s: %s", message.MessageId, err)
+			failedMessageIDs[message.MessageId] = true
+			continue
+		}
+		for _, record := range messageRecords {
+			records = append(records, record)
+			recordMessageIDs = append(recordMessageIDs, message.MessageId)
+		}
+	}
+
+	for i, err := range processor.process(ctx, records) {
+		if err != nil {
+			log.Printf("error handling record of sqs message %s: %s", recordMessageIDs[i], err)
+			failedMessageIDs[recordMessageIDs[i]] = true
+		}
+	}
+
+	response := events.SQSEventResponse{
+		BatchItemFailures: []events.SQSBatchItemFailure{},
+	}
+	for _, message := range messages {
+		if failedMessageIDs[message.MessageId] {
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+	return response
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildTestS3NotificationBody(t *testing.T, keys ...string) string {
+	notification := events.S3Event{}
+	for _, key := range keys {
+		notification.Records = append(notification.Records, events.S3EventRecord{
+			EventSource: s3EventSource,
+			S3: events.S3Entity{
+				Bucket: events.S3Bucket{Name: "test-bucket"},
+				Object: events.S3Object{Key: key},
+			},
+		})
+	}
+	body, err := json.Marshal(notification)
+	assert.NoError(t, err)
+	return string(body)
+}
+
+func Test_handleSQSMessages_partialFailures(t *testing.T) {
+	const testURL = "http://localhost"
+	assert.NoError(t, os.Setenv(epHostEnvKey, testURL))
+	assert.NoError(t, os.Setenv(maxConcurrencyEnvKey, "1"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+		_ = os.Unsetenv(maxConcurrencyEnvKey)
+	})
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder(http.MethodPost, testURL+formattedEndpointSuffix, httpmock.NewStringResponder(http.StatusOK, ""))
+
+	s3Client := &objectsTestS3Client{
+		objects: map[string]string{
+			"key-1": "content-1",
+			"key-2": "content-2",
+		},
+	}
+	processor := newRecordsProcessor(buildTestConfig(t), s3Client, &http.Client{})
+
+	messages := []events.SQSMessage{
+		{
+			MessageId: "success",
+			Body:      buildTestS3NotificationBody(t, "key-1", "key-2"),
+		},
+		{
+			MessageId: "sns-wrapped",
+			Body:      buildTestSNSNotificationBody(t, buildTestS3NotificationBody(t, "key-1")),
+		},
+		{
+			MessageId: "test-event",
+			Body:      `{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"test-bucket"}`,
+		},
+		{
+			MessageId: "missing-object",
+			Body:      buildTestS3NotificationBody(t, "missing-key"),
+		},
+		{
+			MessageId: "invalid-body",
+			Body:      "not json",
+		},
+	}
+
+	response := handleSQSMessages(context.Background(), processor, messages)
+	assert.Equal(t, []events.SQSBatchItemFailure{
+		{ItemIdentifier: "missing-object"},
+		{ItemIdentifier: "invalid-body"},
+	}, response.BatchItemFailures)
+	// duplicated records are only sent once and records of all messages are batched together
+	assert.Equal(t, []string{"key-1", "key-2", "missing-key"}, s3Client.fetchedKeys)
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+}
+
+func Test_handleSQSMessages_hecFailure_messageFailed(t *testing.T) {
+	const testURL = "http://localhost"
+	assert.NoError(t, os.Setenv(epHostEnvKey, testURL))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+	})
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder(http.MethodPost, testURL+formattedEndpointSuffix, httpmock.NewStringResponder(http.StatusForbidden, ""))
+
+	s3Client := &objectsTestS3Client{
+		objects: map[string]string{
+			"key-1": "content-1",
+		},
+	}
+	processor := newRecordsProcessor(buildTestConfig(t), s3Client, &http.Client{})
+
+	response := handleSQSMessages(context.Background(), processor, []events.SQSMessage{
+		{
+			MessageId: "hec-failure",
+			Body:      buildTestS3NotificationBody(t, "key-1"),
+		},
+	})
+	assert.Equal(t, []events.SQSBatchItemFailure{
+		{ItemIdentifier: "hec-failure"},
+	}, response.BatchItemFailures)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	// timezones are embedded as the Lambda runtime may not provide them
+	_ "time/tzdata"
+)
+
+const (
+	timestampFieldEnvKey        = "TIMESTAMP_FIELD"
+	timestampRegexEnvKey        = "TIMESTAMP_REGEX"
+	timestampFormatEnvKey       = "TIMESTAMP_FORMAT"
+	timestampTimezoneEnvKey     = "TIMESTAMP_TIMEZONE"
+	timestampMaxLookaheadEnvKey = "TIMESTAMP_MAX_LOOKAHEAD"
+
+	defaultTimestampMaxLookahead = 128
+
+	// epochTimestampFormat parses epoch seconds, or milli, micro and nanoseconds detected from the number of digits
+	epochTimestampFormat = "%s"
+)
+
+// strptimeDirectives maps strptime directives to Go layouts.
+var strptimeDirectives = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'z': "-0700",
+	'Z': "MST",
+	'f': "000000",
+	'N': "000000000",
+	'T': "15:04:05",
+	'F': "2006-01-02",
+	'%': "%",
+}
+
+// autoTimestampLayouts are tried in order if no format is set and the timestamp isn't an epoch.
+var autoTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05.999999999",
+	"02/Jan/2006:15:04:05 -0700",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.ANSIC,
+}
+
+var epochTimestampRegex = regexp.MustCompile(`^\d{9,10}(\.\d+)?$|^\d{13}$|^\d{16}$|^\d{19}$`)
+
+// layoutLiteralTimes differ in every element of a Go layout, so Go layout tokens in the literal text of
+// a format change when formatted with at least one of them.
+var layoutLiteralTimes = []time.Time{
+	time.Date(1, time.January, 1, 0, 0, 0, 0, time.UTC),
+	time.Date(1999, time.December, 31, 23, 58, 57, 123456789, time.FixedZone("CET", 3600)),
+}
+
+// checkLayoutLiteral fails on literal text which Go would read as layout tokens, such as 1 or Jan.
+func checkLayoutLiteral(literal string) error {
+	for _, layoutTime := range layoutLiteralTimes {
+		if layoutTime.Format(literal) != literal {
+			return fmt.Errorf("%s literal text %q is read as a time element. Digits and names of months, "+
+				"days, time zones or AM/PM must be directives", timestampFormatEnvKey, literal)
+		}
+	}
+	return nil
+}
+
+// strptimeToLayout converts a strptime format such as %Y-%m-%d %H:%M:%S.%3N to a Go layout.
+// %3N and %6N are milli and microseconds. Literal text which Go would read as a time element fails.
+func strptimeToLayout(format string) (string, error) {
+	var layout strings.Builder
+	literalStart := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if err := checkLayoutLiteral(format[literalStart:i]); err != nil {
+			return "", err
+		}
+		layout.WriteString(format[literalStart:i])
+		if i+1 >= len(format) {
+			return "", fmt.Errorf("%s %q ends with %%", timestampFormatEnvKey, format)
+		}
+
+		i++
+		literalStart = i + 1
+		if format[i] >= '1' && format[i] <= '9' && i+1 < len(format) && format[i+1] == 'N' {
+			layout.WriteString(strings.Repeat("0", int(format[i]-'0')))
+			i++
+			literalStart = i + 1
+			continue
+		}
+		directive, found := strptimeDirectives[format[i]]
+		if !found {
+			return "", fmt.Errorf("%s directive %%%c is not supported", timestampFormatEnvKey, format[i])
+		}
+		layout.WriteString(directive)
+	}
+
+	if err := checkLayoutLiteral(format[literalStart:]); err != nil {
+		return "", err
+	}
+	layout.WriteString(format[literalStart:])
+	return layout.String(), nil
+}
+
+func parseTimestampFormat(format string) (string, error) {
+	if format == "" || format == epochTimestampFormat {
+		return format, nil
+	}
+	return strptimeToLayout(format)
+}
+
+func parseTimestampTimezone(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid timezone: %w", timestampTimezoneEnvKey, err)
+	}
+	return location, nil
+}
+
+// parseTimestampField splits a JSON field path such as detail.eventTime.
+func parseTimestampField(field string) []string {
+	if field == "" {
+		return nil
+	}
+	return strings.Split(field, ".")
+}
+
+// timestampExtractor extracts the time of events from their content, either from a JSON field
+// or from the text matched by a regex in the first maxLookahead bytes of the event.
+type timestampExtractor struct {
+	fieldPath    []string
+	regex        *regexp.Regexp
+	layout       string
+	location     *time.Location
+	maxLookahead int
+}
+
+// buildTimestampExtractor returns nil if timestamp extraction isn't configured.
+func buildTimestampExtractor(cfg *Config) *timestampExtractor {
+	if cfg.TimestampField == nil && cfg.TimestampRegex == nil {
+		return nil
+	}
+	return &timestampExtractor{
+		fieldPath:    cfg.TimestampField,
+		regex:        cfg.TimestampRegex,
+		layout:       cfg.TimestampLayout,
+		location:     cfg.TimestampLocation,
+		maxLookahead: cfg.TimestampMaxLookahead,
+	}
+}
+
+// extract returns false if the event has no timestamp which can be parsed.
+func (e *timestampExtractor) extract(event string) (time.Time, bool) {
+	var value string
+	if e.fieldPath != nil {
+		fieldValue, found := e.jsonField(event)
+		if !found {
+			return time.Time{}, false
+		}
+		value = fieldValue
+	} else {
+		lookahead := event
+		if len(lookahead) > e.maxLookahead {
+			lookahead = lookahead[:e.maxLookahead]
+		}
+		match := e.regex.FindStringSubmatch(lookahead)
+		if match == nil {
+			return time.Time{}, false
+		}
+		value = match[0]
+		if len(match) > 1 {
+			value = match[1]
+		}
+	}
+	return e.parse(strings.TrimSpace(value))
+}
+
+// jsonField returns the value of the field at fieldPath as a string. Numbers are kept as written.
+func (e *timestampExtractor) jsonField(event string) (string, bool) {
+	decoder := json.NewDecoder(strings.NewReader(event))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+
+	value, found := lookupJSONField(value, e.fieldPath)
+	if !found {
+		return "", false
+	}
+
+	switch fieldValue := value.(type) {
+	case string:
+		return fieldValue, true
+	case json.Number:
+		return fieldValue.String(), true
+	default:
+		return "", false
+	}
+}
+
+func (e *timestampExtractor) parse(value string) (time.Time, bool) {
+	if e.layout == epochTimestampFormat || (e.layout == "" && epochTimestampRegex.MatchString(value)) {
+		return parseEpoch(value)
+	}
+
+	if e.layout != "" {
+		timestamp, err := time.ParseInLocation(e.layout, value, e.location)
+		return timestamp, err == nil
+	}
+	for _, layout := range autoTimestampLayouts {
+		if timestamp, err := time.ParseInLocation(layout, value, e.location); err == nil {
+			return timestamp, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseEpoch parses epoch seconds with an optional fraction. Integers of 13, 16 and 19 digits
+// are milli, micro and nanoseconds.
+func parseEpoch(value string) (time.Time, bool) {
+	secondsStr, fractionStr, hasFraction := strings.Cut(value, ".")
+	epoch, err := strconv.ParseInt(secondsStr, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if hasFraction {
+		// the fraction is parsed as nanoseconds so it isn't rounded
+		if len(fractionStr) > 9 {
+			fractionStr = fractionStr[:9]
+		}
+		nanos, err := strconv.ParseInt(fractionStr+strings.Repeat("0", 9-len(fractionStr)), 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(epoch, nanos), true
+	}
+
+	switch len(secondsStr) {
+	case 13:
+		return time.UnixMilli(epoch), true
+	case 16:
+		return time.UnixMicro(epoch), true
+	case 19:
+		return time.Unix(0, epoch), true
+	default:
+		return time.Unix(epoch, 0), true
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_strptimeToLayout(t *testing.T) {
+	tests := []struct {
+		format         string
+		expectedLayout string
+	}{
+		{format: "%Y-%m-%d %H:%M:%S.%3N %z", expectedLayout: "2006-01-02 15:04:05.000 -0700"},
+		{format: "%d/%b/%Y:%T", expectedLayout: "02/Jan/2006:15:04:05"},
+		{format: "%FT%T.%f", expectedLayout: "2006-01-02T15:04:05.000000"},
+		{format: "%I%p %%", expectedLayout: "03PM %"},
+		{format: "at %H:%M on %d", expectedLayout: "at 15:04 on 02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			layout, err := strptimeToLayout(tt.format)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedLayout, layout)
+		})
+	}
+}
+
+func Test_strptimeToLayout_invalidFormat_error(t *testing.T) {
+	tests := []struct {
+		format      string
+		expectedErr string
+	}{
+		{format: "%Y-%m-%d %", expectedErr: "ends with %"},
+		{format: "%Y-%m-%d %Q", expectedErr: "directive %Q is not supported"},
+		{format: "%Y-%m-%d 1%H", expectedErr: `literal text " 1" is read as a time element`},
+		{format: "v2 %Y-%m-%d", expectedErr: `literal text "v2 " is read as a time element`},
+		{format: "%Y-%m-%d %H:%M:05", expectedErr: `literal text ":05" is read as a time element`},
+		{format: "%d %H:%M Jan", expectedErr: `literal text " Jan" is read as a time element`},
+		{format: "Monday %Y-%m-%d", expectedErr: `literal text "Monday " is read as a time element`},
+		{format: "%H:%M PM", expectedErr: `literal text " PM" is read as a time element`},
+		{format: "%H:%M MST", expectedErr: `literal text " MST" is read as a time element`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			_, err := strptimeToLayout(tt.format)
+			assert.ErrorContains(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func Test_timestampExtractor_extract(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		extractor    *timestampExtractor
+		event        string
+		expectedTime time.Time
+		expectedOk   bool
+	}{
+		{
+			name:         "json field",
+			extractor:    &timestampExtractor{fieldPath: []string{"eventTime"}, location: time.UTC},
+			event:        `{"eventTime": "2023-06-01T12:00:00.123Z", "eventName": "GetObject"}`,
+			expectedTime: time.Date(2023, 6, 1, 12, 0, 0, 123000000, time.UTC),
+			expectedOk:   true,
+		},
+		{
+			name:         "nested json field in epoch milliseconds",
+			extractor:    &timestampExtractor{fieldPath: []string{"detail", "ts"}, location: time.UTC},
+			event:        `{"detail": {"ts": 1685620800123}}`,
+			expectedTime: time.UnixMilli(1685620800123),
+			expectedOk:   true,
+		},
+		{
+			name:       "missing json field",
+			extractor:  &timestampExtractor{fieldPath: []string{"detail", "ts"}, location: time.UTC},
+			event:      `{"detail": "none"}`,
+			expectedOk: false,
+		},
+		{
+			name:       "event isn't json",
+			extractor:  &timestampExtractor{fieldPath: []string{"ts"}, location: time.UTC},
+			event:      `ts=1685620800`,
+			expectedOk: false,
+		},
+		{
+			name: "regex with format and timezone",
+			extractor: &timestampExtractor{
+				regex:        regexp.MustCompile(`^\[([^\]]+)\]`),
+				layout:       "2006-01-02 15:04:05",
+				location:     newYork,
+				maxLookahead: defaultTimestampMaxLookahead,
+			},
+			event:        "[2023-06-01 08:00:00] GET /index.html",
+			expectedTime: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
+			expectedOk:   true,
+		},
+		{
+			name: "regex with epoch seconds",
+			extractor: &timestampExtractor{
+				regex:        regexp.MustCompile(`time=(\S+)`),
+				location:     time.UTC,
+				maxLookahead: defaultTimestampMaxLookahead,
+			},
+			event:        "level=info time=1685620800.5 msg=started",
+			expectedTime: time.UnixMilli(1685620800500),
+			expectedOk:   true,
+		},
+		{
+			name: "timestamp after max lookahead",
+			extractor: &timestampExtractor{
+				regex:        regexp.MustCompile(`time=(\S+)`),
+				location:     time.UTC,
+				maxLookahead: 10,
+			},
+			event:      "level=info time=1685620800 msg=started",
+			expectedOk: false,
+		},
+		{
+			name: "timestamp doesn't match format",
+			extractor: &timestampExtractor{
+				regex:        regexp.MustCompile(`^\S+`),
+				layout:       "2006-01-02",
+				location:     time.UTC,
+				maxLookahead: defaultTimestampMaxLookahead,
+			},
+			event:      "started at 2023-06-01",
+			expectedOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timestamp, ok := tt.extractor.extract(tt.event)
+			assert.Equal(t, tt.expectedOk, ok)
+			if tt.expectedOk {
+				assert.True(t, tt.expectedTime.Equal(timestamp), "expected %s, got %s", tt.expectedTime, timestamp)
+			}
+		})
+	}
+}
+
+func Test_parseEpoch(t *testing.T) {
+	for value, expected := range map[string]time.Time{
+		"1685620800":          time.Unix(1685620800, 0),
+		"1685620800.123":      time.UnixMilli(1685620800123),
+		"1685620800123":       time.UnixMilli(1685620800123),
+		"1685620800123456":    time.UnixMicro(1685620800123456),
+		"1685620800123456789": time.Unix(0, 1685620800123456789),
+	} {
+		timestamp, ok := parseEpoch(value)
+		assert.True(t, ok)
+		assert.True(t, expected.Equal(timestamp), "%s: expected %s, got %s", value, expected, timestamp)
+	}
+}
+
+func Test_hecPayloadBuilder_build_extractedTimestamps(t *testing.T) {
+	assert.NoError(t, os.Setenv(timestampFieldEnvKey, "time"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(timestampFieldEnvKey)
+	})
+	cfg := buildTestConfig(t)
+	record := buildTestRecord("test-key")
+	record.EventTime = time.UnixMilli(1685620800000)
+
+	var events []hecEvent
+	payloadBuilder := buildPayloadBuilder(cfg, record, buildLineBreaker(cfg), time.UnixMilli(1600000000000))
+	err := payloadBuilder.build(strings.NewReader("{\"time\": 1500000000}\n{\"msg\": \"no time\"}\n"), func(payload []byte) error {
+		var event hecEvent
+		assert.NoError(t, json.Unmarshal(payload, &event))
+		events = append(events, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, float64(1500000000), events[0].Time)
+	// events without timestamp fall back to the object last modified time
+	assert.Equal(t, float64(1600000000), events[1].Time)
+
+	// the notification time is used if the last modified time isn't known
+	payloadBuilder = buildPayloadBuilder(cfg, record, buildLineBreaker(cfg), time.Time{})
+	assert.Equal(t, float64(1685620800), payloadBuilder.template.Time)
+}
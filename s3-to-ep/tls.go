@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	tlsServerNameEnvKey         = "TLS_SERVER_NAME"
+	tlsMinVersionEnvKey         = "TLS_MIN_VERSION"
+	tlsCipherSuitesEnvKey       = "TLS_CIPHER_SUITES"
+	tlsInsecureSkipVerifyEnvKey = "TLS_INSECURE_SKIP_VERIFY"
+
+	defaultTLSMinVersion = tls.VersionTLS12
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTLSMinVersion(version string) (uint16, error) {
+	if version == "" {
+		return defaultTLSMinVersion, nil
+	}
+
+	parsedVersion, found := tlsVersions[version]
+	if !found {
+		return 0, fmt.Errorf("%s must be one of 1.0, 1.1, 1.2 or 1.3, got %q", tlsMinVersionEnvKey, version)
+	}
+	return parsedVersion, nil
+}
+
+// parseTLSCipherSuites parses comma separated cipher suite names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+// Only suites without known security issues are accepted. It returns nil if no suite is provided so Go defaults are used.
+func parseTLSCipherSuites(cipherSuitesStr string) ([]uint16, error) {
+	if cipherSuitesStr == "" {
+		return nil, nil
+	}
+
+	supportedSuites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		supportedSuites[suite.Name] = suite.ID
+	}
+
+	var cipherSuites []uint16
+	for _, name := range strings.Split(cipherSuitesStr, ",") {
+		name = strings.TrimSpace(name)
+		id, found := supportedSuites[name]
+		if !found {
+			return nil, fmt.Errorf("%s cipher suite %q is not supported", tlsCipherSuitesEnvKey, name)
+		}
+		cipherSuites = append(cipherSuites, id)
+	}
+	return cipherSuites, nil
+}
+
+// applyTLSConfig sets the TLS options of cfg on tlsConfig. The server is verified against TLSRootCAs,
+// or the system CAs if not set, whether or not a client certificate is presented.
+func applyTLSConfig(cfg *Config, tlsConfig *tls.Config) {
+	if cfg.TLSCertificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cfg.TLSCertificate}
+	}
+	tlsConfig.RootCAs = cfg.TLSRootCAs
+	tlsConfig.ServerName = cfg.TLSServerName
+	tlsConfig.MinVersion = cfg.TLSMinVersion
+	tlsConfig.CipherSuites = cfg.TLSCipherSuites
+	if cfg.TLSInsecureSkipVerify {
+		log.Printf("WARNING: %s is set. The certificate of the EP server isn't verified, the connection is open to man-in-the-middle attacks. Never use it in production", tlsInsecureSkipVerifyEnvKey)
+		tlsConfig.InsecureSkipVerify = true
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseTLSCipherSuites(t *testing.T) {
+	cipherSuites, err := parseTLSCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}, cipherSuites)
+
+	cipherSuites, err = parseTLSCipherSuites("")
+	assert.NoError(t, err)
+	assert.Nil(t, cipherSuites)
+}
+
+func Test_buildHTTPClient_caCertOnly_verifiesServer(t *testing.T) {
+	assert.NoError(t, os.Setenv(epHostEnvKey, "https://ep.internal:8088"))
+	assert.NoError(t, os.Setenv(epTLSCACertEnvKey, testTLSCACert))
+	assert.NoError(t, os.Setenv(tlsServerNameEnvKey, "ep.example.com"))
+	assert.NoError(t, os.Setenv(tlsMinVersionEnvKey, "1.3"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(epHostEnvKey)
+		_ = os.Unsetenv(epTLSCACertEnvKey)
+		_ = os.Unsetenv(tlsServerNameEnvKey)
+		_ = os.Unsetenv(tlsMinVersionEnvKey)
+	})
+
+	client := buildHTTPClient(buildTestConfig(t))
+	castedTransport, isHTTPTransport := client.Transport.(*http.Transport)
+	assert.True(t, isHTTPTransport)
+	tlsConfig := castedTransport.TLSClientConfig
+	assert.Empty(t, tlsConfig.Certificates)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Equal(t, "ep.example.com", tlsConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+}
+
+func Test_buildHTTPClient_insecureSkipVerify(t *testing.T) {
+	assert.NoError(t, os.Setenv(tlsInsecureSkipVerifyEnvKey, "true"))
+	assert.NoError(t, os.Setenv(tlsCipherSuitesEnvKey, "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"))
+	t.Cleanup(func() {
+		_ = os.Unsetenv(tlsInsecureSkipVerifyEnvKey)
+		_ = os.Unsetenv(tlsCipherSuitesEnvKey)
+	})
+
+	client := buildHTTPClient(buildTestConfig(t))
+	castedTransport, isHTTPTransport := client.Transport.(*http.Transport)
+	assert.True(t, isHTTPTransport)
+	assert.True(t, castedTransport.TLSClientConfig.InsecureSkipVerify)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, castedTransport.TLSClientConfig.CipherSuites)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	vpcFlowLogOutputEnvKey = "VPC_FLOW_LOG_OUTPUT"
+
+	vpcFlowLogSourcetype = "aws:cloudwatchlogs:vpcflow"
+	vpcFlowLogStartField = "start"
+)
+
+// vpcFlowLogKeyRegex matches the keys of flow log files, including Hive-compatible prefixes:
+// [prefix/]AWSLogs/[aws-account-id=]account/[aws-service=]vpcflowlogs/...
+var vpcFlowLogKeyRegex = regexp.MustCompile(`(^|/)AWSLogs/(aws-account-id=)?\d{12}/(aws-service=)?vpcflowlogs/`)
+
+// vpcFlowLogDecoder emits each flow record of a VPC flow log file as an event. Text files start with
+// a header line giving the field order of the flow log format. Parquet files are read row by row with
+// the fields named by their columns, with decodeParquet as they can't be streamed.
+type vpcFlowLogDecoder struct {
+	output       string
+	maxEventSize int
+}
+
+func (d *vpcFlowLogDecoder) decode(reader io.Reader, emit func(event decodedEvent) error) error {
+	bufferedReader := bufio.NewReader(reader)
+	magicBytes, _ := bufferedReader.Peek(len(parquetMagicBytes))
+	if bytes.Equal(magicBytes, parquetMagicBytes) {
+		return errStreamedParquetContent
+	}
+	return d.decodeText(bufferedReader, emit)
+}
+
+func (d *vpcFlowLogDecoder) decodeText(reader io.Reader, emit func(event decodedEvent) error) error {
+	var fieldNames []string
+	return decodeLines(reader, d.maxEventSize, func(line string) error {
+		if fieldNames == nil {
+			fieldNames = normalizeVPCFlowLogFieldNames(strings.Fields(line))
+			return nil
+		}
+		return emit(d.buildEvent(fieldNames, strings.Fields(line)))
+	})
+}
+
+func (d *vpcFlowLogDecoder) decodeParquet(file *parquet.File, emit func(event decodedEvent) error) error {
+	var fieldNames []string
+	for _, column := range file.Schema().Columns() {
+		fieldNames = append(fieldNames, strings.Join(column, "."))
+	}
+	fieldNames = normalizeVPCFlowLogFieldNames(fieldNames)
+
+	return readParquetRows(file, func(row parquet.Row) error {
+		values := make([]string, len(fieldNames))
+		for i := range values {
+			values[i] = recordNoData
+		}
+		for _, value := range row {
+			if !value.IsNull() && value.Column() < len(values) {
+				values[value.Column()] = value.String()
+			}
+		}
+		return emit(d.buildEvent(fieldNames, values))
+	})
+}
+
+// buildEvent builds the event of a flow record. The event time is the start of the flow.
+func (d *vpcFlowLogDecoder) buildEvent(fieldNames, values []string) decodedEvent {
+	event := buildRecordEvent(d.output, strings.Join(values, " "), fieldNames, values)
+	for i, name := range fieldNames {
+		if name == vpcFlowLogStartField && i < len(values) {
+			if startTime, ok := parseEpoch(values[i]); ok {
+				event.time = startTime
+			}
+		}
+	}
+	return event
+}
+
+// normalizeVPCFlowLogFieldNames names fields the same way in text and Parquet files, for example
+// account-id in text headers and account_id in Parquet columns are both account_id.
+func normalizeVPCFlowLogFieldNames(fieldNames []string) []string {
+	normalizedNames := make([]string, len(fieldNames))
+	for i, name := range fieldNames {
+		normalizedNames[i] = strings.ReplaceAll(name, "-", "_")
+	}
+	return normalizedNames
+}
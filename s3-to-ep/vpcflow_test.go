@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarcoal/httpmock"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testVPCFlowLogFile = "version account-id interface-id srcaddr dstaddr srcport dstport protocol packets bytes start end action log-status\n" +
+	"2 123456789012 eni-1235b8ca 172.31.16.139 172.31.16.21 20641 22 6 20 4249 1685620800 1685620860 ACCEPT OK\n" +
+	"2 123456789012 eni-1235b8ca - - - - - - - 1685620860 1685620920 - NODATA\n"
+
+type testVPCFlowLogRecord struct {
+	Version   int32   `parquet:"version,optional"`
+	AccountID string  `parquet:"account_id,optional"`
+	SrcAddr   *string `parquet:"srcaddr,optional"`
+	Start     int64   `parquet:"start,optional"`
+	Action    *string `parquet:"action,optional"`
+}
+
+func Test_vpcFlowLogDecoder_decode_text(t *testing.T) {
+	tests := []struct {
+		name           string
+		output         string
+		expectedEvents []decodedEvent
+	}{
+		{
+			name:   "raw",
+			output: rawRecordOutput,
+			expectedEvents: []decodedEvent{
+				{
+					content: "2 123456789012 eni-1235b8ca 172.31.16.139 172.31.16.21 20641 22 6 20 4249 1685620800 1685620860 ACCEPT OK",
+					time:    time.Unix(1685620800, 0),
+				},
+				{
+					content: "2 123456789012 eni-1235b8ca - - - - - - - 1685620860 1685620920 - NODATA",
+					time:    time.Unix(1685620860, 0),
+				},
+			},
+		},
+		{
+			name:   "json",
+			output: jsonRecordOutput,
+			expectedEvents: []decodedEvent{
+				{
+					content: `{"version":"2","account_id":"123456789012","interface_id":"eni-1235b8ca","srcaddr":"172.31.16.139",` +
+						`"dstaddr":"172.31.16.21","srcport":"20641","dstport":"22","protocol":"6","packets":"20","bytes":"4249",` +
+						`"start":"1685620800","end":"1685620860","action":"ACCEPT","log_status":"OK"}`,
+					time: time.Unix(1685620800, 0),
+				},
+				{
+					content: `{"version":"2","account_id":"123456789012","interface_id":"eni-1235b8ca",` +
+						`"start":"1685620860","end":"1685620920","log_status":"NODATA"}`,
+					time: time.Unix(1685620860, 0),
+				},
+			},
+		},
+		{
+			name:   "fields",
+			output: fieldsRecordOutput,
+			expectedEvents: []decodedEvent{
+				{
+					content: "2 123456789012 eni-1235b8ca 172.31.16.139 172.31.16.21 20641 22 6 20 4249 1685620800 1685620860 ACCEPT OK",
+					time:    time.Unix(1685620800, 0),
+					fields: map[string]string{
+						"version": "2", "account_id": "123456789012", "interface_id": "eni-1235b8ca", "srcaddr": "172.31.16.139",
+						"dstaddr": "172.31.16.21", "srcport": "20641", "dstport": "22", "protocol": "6", "packets": "20", "bytes": "4249",
+						"start": "1685620800", "end": "1685620860", "action": "ACCEPT", "log_status": "OK",
+					},
+				},
+				{
+					content: "2 123456789012 eni-1235b8ca - - - - - - - 1685620860 1685620920 - NODATA",
+					time:    time.Unix(1685620860, 0),
+					fields: map[string]string{
+						"version": "2", "account_id": "123456789012", "interface_id": "eni-1235b8ca",
+						"start": "1685620860", "end": "1685620920", "log_status": "NODATA",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decodedEvents []decodedEvent
+			err := (&vpcFlowLogDecoder{output: tt.output, maxEventSize: defaultMaxEventSize}).decode(strings.NewReader(testVPCFlowLogFile), func(event decodedEvent) error {
+				decodedEvents = append(decodedEvents, event)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedEvents, decodedEvents)
+		})
+	}
+}
+
+func Test_vpcFlowLogDecoder_decode_customFormat(t *testing.T) {
+	content := "srcaddr dstaddr action\r\n10.0.0.1 10.0.0.2 REJECT\r\n\r\n"
+
+	var decodedEvents []decodedEvent
+	err := (&vpcFlowLogDecoder{output: jsonRecordOutput, maxEventSize: defaultMaxEventSize}).decode(strings.NewReader(content), func(event decodedEvent) error {
+		decodedEvents = append(decodedEvents, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	// the time is unknown without the start field
+	assert.Equal(t, []decodedEvent{{content: `{"srcaddr":"10.0.0.1","dstaddr":"10.0.0.2","action":"REJECT"}`}}, decodedEvents)
+}
+
+func Test_vpcFlowLogDecoder_decode_lineBiggerThanMaxEventSize_truncated(t *testing.T) {
+	content := "srcaddr dstaddr action\n10.0.0.1 10.0.0.2 " + strings.Repeat("A", 10000) + "\n10.0.0.3 10.0.0.4 ACCEPT\n"
+
+	var decodedEvents []decodedEvent
+	err := (&vpcFlowLogDecoder{output: rawRecordOutput, maxEventSize: 24}).decode(strings.NewReader(content), func(event decodedEvent) error {
+		decodedEvents = append(decodedEvents, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []decodedEvent{
+		{content: "10.0.0.1 10.0.0.2 AAAAAA"},
+		{content: "10.0.0.3 10.0.0.4 ACCEPT"},
+	}, decodedEvents)
+}
+
+func Test_vpcFlowLogDecoder_decodeParquet(t *testing.T) {
+	srcAddr, action := "172.31.16.139", "ACCEPT"
+	var content bytes.Buffer
+	assert.NoError(t, parquet.Write(&content, []testVPCFlowLogRecord{
+		{Version: 5, AccountID: "123456789012", SrcAddr: &srcAddr, Start: 1685620800, Action: &action},
+		{Version: 5, AccountID: "123456789012", Start: 1685620860},
+	}))
+
+	tests := []struct {
+		name           string
+		output         string
+		expectedEvents []decodedEvent
+	}{
+		{
+			name:   "raw",
+			output: rawRecordOutput,
+			expectedEvents: []decodedEvent{
+				{content: "5 123456789012 172.31.16.139 1685620800 ACCEPT", time: time.Unix(1685620800, 0)},
+				{content: "5 123456789012 - 1685620860 -", time: time.Unix(1685620860, 0)},
+			},
+		},
+		{
+			name:   "json",
+			output: jsonRecordOutput,
+			expectedEvents: []decodedEvent{
+				{
+					content: `{"version":"5","account_id":"123456789012","srcaddr":"172.31.16.139","start":"1685620800","action":"ACCEPT"}`,
+					time:    time.Unix(1685620800, 0),
+				},
+				{
+					content: `{"version":"5","account_id":"123456789012","start":"1685620860"}`,
+					time:    time.Unix(1685620860, 0),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decodedEvents := decodeTestParquetFile(t, &vpcFlowLogDecoder{output: tt.output}, content.Bytes())
+			assert.Equal(t, tt.expectedEvents, decodedEvents)
+		})
+	}
+}
+
+func Test_vpcFlowLogDecoder_decode_streamedParquet_error(t *testing.T) {
+	err := (&vpcFlowLogDecoder{}).decode(strings.NewReader("PAR1 truncated"), func(event decodedEvent) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, errStreamedParquetContent)
+}
+
+func Test_recordsProcessor_process_vpcFlowLogs(t *testing.T) {
+	const logKey = "AWSLogs/123456789012/vpcflowlogs/us-west-2/2023/06/01/file.log.gz"
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var hecEvents []hecEvent
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost"+formattedEndpointSuffix, func(req *http.Request) (*http.Response, error) {
+		decoder := json.NewDecoder(req.Body)
+		for decoder.More() {
+			var event hecEvent
+			assert.NoError(t, decoder.Decode(&event))
+			hecEvents = append(hecEvents, event)
+		}
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	cfg := buildTestConfig(t)
+	cfg.VPCFlowLogOutput = fieldsRecordOutput
+	cfg.Fields = map[string]string{"team": "network", "action": "overridden"}
+	s3Client := &objectsTestS3Client{objects: map[string]string{logKey: testVPCFlowLogFile}}
+	h := newHandler(cfg, s3Client, &http.Client{}, &mapTestSecretsManagerClient{})
+
+	errs := h.processor.process(context.Background(), []events.S3EventRecord{buildTestRecord(logKey)})
+	assert.Equal(t, []error{nil}, errs)
+
+	assert.Len(t, hecEvents, 2)
+	assert.Equal(t, vpcFlowLogSourcetype, hecEvents[0].Sourcetype)
+	assert.Equal(t, float64(1685620800), hecEvents[0].Time)
+	assert.Equal(t, "network", hecEvents[0].Fields["team"])
+	// fields of the flow record are added on top of the configured fields
+	assert.Equal(t, "ACCEPT", hecEvents[0].Fields["action"])
+	assert.Equal(t, "172.31.16.139", hecEvents[0].Fields["srcaddr"])
+	assert.Equal(t, "overridden", hecEvents[1].Fields["action"])
+	assert.Equal(t, "NODATA", hecEvents[1].Fields["log_status"])
+	// the configured fields are shared by events and must not be changed
+	assert.Equal(t, map[string]string{"team": "network", "action": "overridden"}, cfg.Fields)
+}